@@ -0,0 +1,168 @@
+package anilist
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/db"
+	"everythingtracker/provider"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoAccount is returned for syncs of users who haven't set their account at the provider
+var ErrNoAccount = errors.New("no account at this provider set for the user, set it with PUT /accounts/{provider}")
+
+// Account is the account of a local user at a provider, syncs of the user fetch its list
+// Local usernames and provider accounts are unrelated, so every user sets theirs once per provider
+type Account struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Username  string    `gorm:"uniqueIndex:idx_provider_accounts_user_provider" json:"username"`
+	Provider  string    `gorm:"uniqueIndex:idx_provider_accounts_user_provider" json:"provider"`
+	Name      string    `json:"name"` // user name at the provider, the account ID for TMDB
+}
+
+// TableName sets the table name for provider accounts
+func (Account) TableName() string {
+	return "provider_accounts"
+}
+
+// AccountRequest sets the account of a user at a provider
+type AccountRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// AccountName returns the account a user set for a provider, or ErrNoAccount
+func AccountName(username, providerName string) (string, error) {
+	var a Account
+	if err := db.DB.Where("username = ? AND provider = ?", username, providerName).Limit(1).Find(&a).Error; err != nil {
+		return "", err
+	}
+	if a.Name == "" {
+		return "", ErrNoAccount
+	}
+	return a.Name, nil
+}
+
+// SetAccount stores the account of a user at a provider, replacing a previous one
+func SetAccount(username, providerName, name string) (*Account, error) {
+	a := Account{Username: username, Provider: providerName, Name: name}
+	err := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}, {Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+	}).Create(&a).Error
+	if err != nil {
+		return nil, err
+	}
+	db.DB.Where("username = ? AND provider = ?", username, providerName).First(&a)
+	return &a, nil
+}
+
+// GetAccountsHandler godoc
+// @Summary List a user's provider accounts
+// @Description Returns the accounts at providers whose lists syncs of the user fetch.
+// @Tags sync
+// @Produce json
+// @Param username query string false "Owner of the accounts, defaults to the caller"
+// @Success 200 {array} Account
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /accounts [get]
+// GetAccountsHandler handles GET requests for provider accounts
+func GetAccountsHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	accounts := []Account{}
+	if err := db.DB.Where("username = ?", username).Order("provider").Find(&accounts).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, accounts)
+}
+
+// PutAccountHandler godoc
+// @Summary Set a user's account at a provider
+// @Description Sets the account whose list syncs of the user fetch from the provider: the user name at AniList and RAWG, the account ID at TMDB.
+// @Description Linking an AniList account sets it automatically. A linked AniList token is only used while the account is the linked one.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param provider path string true "Metadata provider" default(anilist)
+// @Param account body AccountRequest true "Account name, username defaults to the caller"
+// @Success 200 {object} Account
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /accounts/{provider} [put]
+// PutAccountHandler handles updates of provider accounts
+func PutAccountHandler(c *gin.Context) {
+	p, err := provider.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error() + ": " + c.Param("provider")})
+		return
+	}
+
+	var req AccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if req.Username, ok = auth.Username(c, req.Username); !ok {
+		return
+	}
+	if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+		c.JSON(400, gin.H{"error": "name is required"})
+		return
+	}
+
+	a, err := SetAccount(req.Username, p.Name(), req.Name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, a)
+}
+
+// DeleteAccountHandler godoc
+// @Summary Remove a user's account at a provider
+// @Description Removes the account, syncs of the user from the provider fail until one is set again.
+// @Tags sync
+// @Param provider path string true "Metadata provider" default(anilist)
+// @Param username query string false "Owner of the account, defaults to the caller"
+// @Success 204
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /accounts/{provider} [delete]
+// DeleteAccountHandler handles removal of provider accounts
+func DeleteAccountHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	res := db.DB.Where("username = ? AND provider = ?", username, c.Param("provider")).Delete(&Account{})
+	if res.Error != nil {
+		c.JSON(500, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "no " + c.Param("provider") + " account set for this user"})
+		return
+	}
+	c.Status(204)
+}
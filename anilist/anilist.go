@@ -2,11 +2,79 @@
 package anilist
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"everythingtracker/base"
+	"everythingtracker/push"
 
 	"github.com/rl404/verniy"
 )
 
+// Media type names used in routes and the progress history
+const (
+	MediaTypeAnime = "anime"
+	MediaTypeManga = "manga"
+)
+
+// AnimeType and MangaType are the media types cataloged by AniList, they are registered by RegisterMediaTypes
+var (
+	AnimeType = base.MediaType{
+		Name:         MediaTypeAnime,
+		Table:        Anime{}.TableName(),
+		ProgressUnit: "ep",
+		Statuses:     []base.MediaStatus{base.StatusPlanningWatch, base.StatusWatching, base.StatusCompleted, base.StatusDropped, base.StatusPaused, base.StatusRewatching},
+		Active:       base.StatusWatching,
+		Repeating:    base.StatusRewatching,
+		Providers:    []string{Provider{}.Name()},
+	}
+	MangaType = base.MediaType{
+		Name:         MediaTypeManga,
+		Table:        Manga{}.TableName(),
+		ProgressUnit: "ch",
+		Statuses:     []base.MediaStatus{base.StatusPlanningRead, base.StatusReading, base.StatusCompleted, base.StatusDropped, base.StatusPaused, base.StatusRereading},
+		Active:       base.StatusReading,
+		Repeating:    base.StatusRereading,
+		Providers:    []string{Provider{}.Name()},
+	}
+)
+
+// RegisterMediaTypes registers anime and manga
+func RegisterMediaTypes() {
+	base.RegisterMediaType(AnimeType)
+	base.RegisterMediaType(MangaType)
+}
+
+// MediaListFieldScore100 requests the list score on the 0-100 scale regardless of the user's score format
+const MediaListFieldScore100 verniy.MediaListField = "score(format: POINT_100)"
+
+// GraphQLEndpoint replaces the AniList GraphQL API for all requests when set
+var GraphQLEndpoint string
+
+// newClient returns an AniList client, authenticated as the owner of token unless it is empty
+func newClient(token string) *verniy.Client {
+	v := verniy.New()
+	if GraphQLEndpoint != "" {
+		v.Host = GraphQLEndpoint
+	}
+	v.AccessToken = token
+	return v
+}
+
+// userClient returns a client for fetching the lists of the AniList user account for the local user username
+// It is authenticated as the user if they linked that account and anonymous otherwise, private lists can only be fetched authenticated
+func userClient(username, account string) (*verniy.Client, error) {
+	token, err := accountToken(username, account)
+	if errors.Is(err, push.ErrNoToken) {
+		return newClient(""), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newClient(token), nil
+}
+
 // ExtractTitle extracts the title from AniList media entry
 // Prefers English title, falls back to Romaji, then "Unknown Title"
 func ExtractTitle(mediaID int, media *verniy.Media) string {
@@ -25,26 +93,51 @@ func ExtractTitle(mediaID int, media *verniy.Media) string {
 	return title
 }
 
+// FuzzyDateToTime converts an AniList fuzzy date to a time
+// Missing month or day default to the first, a missing year yields nil
+func FuzzyDateToTime(date *verniy.FuzzyDate) *time.Time {
+	if date == nil || date.Year == nil {
+		return nil
+	}
+
+	month, day := 1, 1
+	if date.Month != nil {
+		month = *date.Month
+	}
+	if date.Day != nil {
+		day = *date.Day
+	}
+
+	t := time.Date(*date.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
 // MapAniListStatus maps AniList status to internal MediaStatus
-func MapAniListStatus(status string, isAnime bool) base.MediaStatus {
+// Unknown statuses are reported as an error
+func MapAniListStatus(status string, isAnime bool) (base.MediaStatus, error) {
 	switch status {
 	case "CURRENT":
 		if isAnime {
-			return base.StatusWatching
+			return base.StatusWatching, nil
 		}
-		return base.StatusReading
+		return base.StatusReading, nil
 	case "PLANNING":
 		if isAnime {
-			return base.StatusPlanningWatch
+			return base.StatusPlanningWatch, nil
+		}
+		return base.StatusPlanningRead, nil
+	case "REPEATING":
+		if isAnime {
+			return base.StatusRewatching, nil
 		}
-		return base.StatusPlanningRead
+		return base.StatusRereading, nil
 	case "COMPLETED":
-		return base.StatusCompleted
+		return base.StatusCompleted, nil
 	case "DROPPED":
-		return base.StatusDropped
+		return base.StatusDropped, nil
 	case "PAUSED":
-		return base.StatusPaused
+		return base.StatusPaused, nil
 	default:
-		return base.StatusPlanningWatch
+		return "", fmt.Errorf("unknown AniList status %q", status)
 	}
 }
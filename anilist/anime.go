@@ -2,6 +2,7 @@ package anilist
 
 import (
 	"everythingtracker/base"
+	"fmt"
 	"time"
 
 	"github.com/rl404/verniy"
@@ -16,17 +17,27 @@ func (Anime) TableName() string {
 	return "animes"
 }
 
-func FetchAniListAnime(username string) ([]Anime, error) {
-	v := verniy.New()
+// FetchAniListAnime fetches the anime list of the AniList user account for the local user username
+// The list is fetched with the token of the user if it belongs to the account, so private lists can be synced
+func FetchAniListAnime(username, account string) ([]Anime, error) {
+	v, err := userClient(username, account)
+	if err != nil {
+		return nil, err
+	}
 
 	collection, err := v.GetUserAnimeList(
-		username,
+		account,
 		verniy.MediaListGroupFieldName,
 		verniy.MediaListGroupFieldStatus,
 		verniy.MediaListGroupFieldEntries(
 			verniy.MediaListFieldID,
 			verniy.MediaListFieldStatus,
 			verniy.MediaListFieldProgress,
+			MediaListFieldScore100,
+			verniy.MediaListFieldNotes,
+			verniy.MediaListFieldRepeat,
+			verniy.MediaListFieldStartedAt,
+			verniy.MediaListFieldCompletedAt,
 			verniy.MediaListFieldCreatedAt,
 			verniy.MediaListFieldUpdatedAt,
 			verniy.MediaListFieldMedia(
@@ -48,10 +59,22 @@ func FetchAniListAnime(username string) ([]Anime, error) {
 
 	for _, list := range collection {
 		for _, entry := range list.Entries {
+			// entries without media can't be keyed, an entry without a status is an incomplete response
+			if entry.Media == nil {
+				continue
+			}
+			if entry.Status == nil {
+				return nil, fmt.Errorf("media id %d: entry has no status", entry.Media.ID)
+			}
+			progress := 0.0
+			if entry.Progress != nil {
+				progress = float64(*entry.Progress)
+			}
+
 			// for not yet released anime, ProgressTotal is not available, so we set it to 0
 			progressTotal := 0.0
 
-			if entry.Media != nil && entry.Media.Episodes != nil {
+			if entry.Media.Episodes != nil {
 				progressTotal = float64(*entry.Media.Episodes)
 			} else {
 				print("No episode count found for media id ", entry.Media.ID, "\n")
@@ -61,10 +84,25 @@ func FetchAniListAnime(username string) ([]Anime, error) {
 			item := Anime{}
 			item.Title = ExtractTitle(entry.Media.ID, entry.Media)
 			item.ExternalID = entry.Media.ID
-			item.Status = MapAniListStatus(string(*entry.Status), true)
-			item.ProgressCurrent = float64(*entry.Progress)
+			status, err := MapAniListStatus(string(*entry.Status), true)
+			if err != nil {
+				return nil, fmt.Errorf("media id %d: %w", entry.Media.ID, err)
+			}
+			item.Status = status
+			item.ProgressCurrent = progress
 			item.ProgressTotal = progressTotal
 			item.ProgressUnit = "ep"
+			if entry.Score != nil {
+				item.Score = *entry.Score
+			}
+			if entry.Repeat != nil {
+				item.RepeatCount = *entry.Repeat
+			}
+			if entry.Notes != nil {
+				item.Notes = *entry.Notes
+			}
+			item.StartedAt = FuzzyDateToTime(entry.StartedAt)
+			item.CompletedAt = FuzzyDateToTime(entry.CompletedAt)
 			if entry.CreatedAt != nil {
 				item.CreatedAt = time.Unix(int64(*entry.CreatedAt), 0).UTC()
 			}
@@ -78,7 +116,7 @@ func FetchAniListAnime(username string) ([]Anime, error) {
 }
 
 func SearchAnilistAnime(query string, searchCount int) ([]Anime, error) {
-	v := verniy.New()
+	v := newClient("")
 
 	searchPage, err := v.SearchAnime(verniy.PageParamMedia{Search: query}, 1, searchCount)
 	if err != nil {
@@ -97,7 +135,7 @@ func SearchAnilistAnime(query string, searchCount int) ([]Anime, error) {
 }
 
 func GetAnimeByExternalID(externalID int) (*Anime, error) {
-	v := verniy.New()
+	v := newClient("")
 
 	media, err := v.GetAnime(externalID)
 	if err != nil {
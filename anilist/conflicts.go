@@ -0,0 +1,330 @@
+package anilist
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/push"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConflictPolicy decides which copy of an entry a sync keeps when it differs locally and at the provider
+type ConflictPolicy string
+
+const (
+	PolicyRemoteWins      ConflictPolicy = "remote-wins"       // the provider's copy always wins
+	PolicyLocalWins       ConflictPolicy = "local-wins"        // fields edited locally since the last sync are kept
+	PolicyNewestWins      ConflictPolicy = "newest-wins"       // the copy updated last wins
+	PolicyMaxProgressWins ConflictPolicy = "max-progress-wins" // the copy with more progress wins, ties go to the newest
+	PolicyFieldMerge      ConflictPolicy = "field-merge"       // fields changed on one side are merged, fields changed on both are conflicts
+)
+
+// DefaultPolicy is used for users who haven't chosen a policy
+const DefaultPolicy = PolicyNewestWins
+
+// Valid reports whether p is one of the known conflict policies
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case PolicyRemoteWins, PolicyLocalWins, PolicyNewestWins, PolicyMaxProgressWins, PolicyFieldMerge:
+		return true
+	}
+	return false
+}
+
+// SyncPolicy is the conflict policy a user chose for syncs from a provider
+type SyncPolicy struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Username  string         `gorm:"uniqueIndex:idx_sync_policies_user_provider" json:"username"`
+	Provider  string         `gorm:"uniqueIndex:idx_sync_policies_user_provider;default:anilist" json:"provider"`
+	Policy    ConflictPolicy `json:"policy"`
+}
+
+// TableName sets the table name for sync policies
+func (SyncPolicy) TableName() string {
+	return "sync_policies"
+}
+
+// Conflict is a field a field-merge couldn't decide, the item keeps its local value until it is resolved
+type Conflict struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Username   string     `json:"username"`
+	Provider   string     `json:"provider"`
+	MediaType  string     `json:"media_type"`
+	ExternalID int        `json:"external_id"`
+	Title      string     `json:"title"`
+	Field      string     `json:"field"`
+	Local      any        `gorm:"serializer:json" json:"local"`
+	Remote     any        `gorm:"serializer:json" json:"remote"`
+	Resolution string     `json:"resolution"` // local or remote, empty while open
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+// TableName sets the table name for sync conflicts
+func (Conflict) TableName() string {
+	return "sync_conflicts"
+}
+
+// openConflict refreshes an open conflict on the same field instead of adding another one
+var openConflict = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "username"}, {Name: "provider"}, {Name: "media_type"}, {Name: "external_id"}, {Name: "field"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "resolved_at IS NULL"}}},
+	DoUpdates:   clause.AssignmentColumns([]string{"title", "local", "remote", "updated_at"}),
+}
+
+// MigrateSync creates the provider account, sync policy and conflict tables and the index allowing one open conflict per field
+func MigrateSync() error {
+	if err := db.DB.AutoMigrate(&Account{}, &SyncPolicy{}, &Conflict{}); err != nil {
+		return err
+	}
+	return db.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_conflicts_open ON sync_conflicts(username, provider, media_type, external_id, field) WHERE resolved_at IS NULL").Error
+}
+
+// UserPolicy returns the conflict policy a user chose for a provider, or DefaultPolicy
+func UserPolicy(username, providerName string) (ConflictPolicy, error) {
+	var p SyncPolicy
+	err := db.DB.Where("username = ? AND provider = ?", username, providerName).Limit(1).Find(&p).Error
+	if err != nil {
+		return "", err
+	}
+	if p.Policy == "" {
+		return DefaultPolicy, nil
+	}
+	return p.Policy, nil
+}
+
+// SyncPolicyRequest sets the conflict policy of a user
+type SyncPolicyRequest struct {
+	Username string         `json:"username"`
+	Provider string         `json:"provider"`
+	Policy   ConflictPolicy `json:"policy"`
+}
+
+// ResolveRequest picks the side that wins a conflict
+type ResolveRequest struct {
+	Keep string `json:"keep"` // local or remote
+}
+
+// GetSyncPolicyHandler godoc
+// @Summary Get a user's sync conflict policy
+// @Description Returns the policy used when an entry differs locally and at the provider. Users who haven't chosen one get newest-wins.
+// @Tags sync
+// @Produce json
+// @Param username query string false "Username of the policy, defaults to the caller"
+// @Param provider query string false "Provider synced from" default(anilist)
+// @Success 200 {object} SyncPolicy
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /sync/policy [get]
+// GetSyncPolicyHandler handles GET requests for sync policies
+func GetSyncPolicyHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+	providerName := c.DefaultQuery("provider", base.DefaultProvider)
+
+	p := SyncPolicy{Username: username, Provider: providerName, Policy: DefaultPolicy}
+	if err := db.DB.Where("username = ? AND provider = ?", username, providerName).Limit(1).Find(&p).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, p)
+}
+
+// PutSyncPolicyHandler godoc
+// @Summary Set a user's sync conflict policy
+// @Description Sets the policy used by syncs of the user that don't pass one: remote-wins, local-wins, newest-wins,
+// @Description max-progress-wins or field-merge.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param policy body SyncPolicyRequest true "Policy settings"
+// @Success 200 {object} SyncPolicy
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /sync/policy [put]
+// PutSyncPolicyHandler handles updates of sync policies
+func PutSyncPolicyHandler(c *gin.Context) {
+	var req SyncPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if req.Username, ok = auth.Username(c, req.Username); !ok {
+		return
+	}
+	if !req.Policy.Valid() {
+		c.JSON(400, gin.H{"error": "unknown conflict policy: " + string(req.Policy)})
+		return
+	}
+
+	p := SyncPolicy{Username: req.Username, Provider: req.Provider, Policy: req.Policy}
+	if p.Provider == "" {
+		p.Provider = base.DefaultProvider
+	}
+	err := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}, {Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"policy", "updated_at"}),
+	}).Create(&p).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.DB.Where("username = ? AND provider = ?", p.Username, p.Provider).First(&p)
+	c.JSON(200, p)
+}
+
+// GetConflictsHandler godoc
+// @Summary List open sync conflicts of a user
+// @Description Returns the fields a field-merge sync couldn't decide because they changed both locally and at the provider, oldest first.
+// @Tags sync
+// @Produce json
+// @Param username query string false "Owner of the conflicts, defaults to the caller"
+// @Param provider query string false "Only conflicts with this provider"
+// @Param media_type query string false "Only conflicts of this media type"
+// @Success 200 {array} Conflict
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /conflicts [get]
+// GetConflictsHandler handles GET requests for sync conflicts
+func GetConflictsHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	tx := db.DB.Where("username = ? AND resolved_at IS NULL", username)
+	if p := c.Query("provider"); p != "" {
+		tx = tx.Where("provider = ?", p)
+	}
+	if t := c.Query("media_type"); t != "" {
+		tx = tx.Where("media_type = ?", t)
+	}
+
+	conflicts := []Conflict{}
+	if err := tx.Order("id").Find(&conflicts).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, conflicts)
+}
+
+// ResolveConflictHandler godoc
+// @Summary Resolve a sync conflict
+// @Description Keeps either the local value of the field or the provider's value from the last sync.
+// @Description Keeping the local value leaves the item untouched, later syncs won't raise the conflict again until the provider changes the field.
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Param id path int true "Conflict ID"
+// @Param resolution body ResolveRequest true "Side to keep"
+// @Success 200 {object} Conflict
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /conflicts/{id}/resolve [post]
+// ResolveConflictHandler handles resolution of sync conflicts
+func ResolveConflictHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	var req ResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Keep != "local" && req.Keep != "remote" {
+		c.JSON(400, gin.H{"error": "keep must be local or remote"})
+		return
+	}
+
+	var conflict Conflict
+	err = db.DB.First(&conflict, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "conflict not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := auth.Username(c, conflict.Username); !ok {
+		return
+	}
+	if conflict.ResolvedAt != nil {
+		c.JSON(409, gin.H{"error": "conflict is already resolved"})
+		return
+	}
+
+	if req.Keep == "remote" {
+		t, ok := base.LookupMediaType(conflict.MediaType)
+		if !ok {
+			c.JSON(500, gin.H{"error": "unknown media type: " + conflict.MediaType})
+			return
+		}
+		key := db.ItemKey{Username: conflict.Username, Provider: conflict.Provider, ExternalID: conflict.ExternalID}
+		item, ok := findItem(c, t, key)
+		if !ok {
+			return
+		}
+		if err := keepRemote(t, conflict, item); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now()
+	conflict.Resolution, conflict.ResolvedAt = req.Keep, &now
+	if err := db.DB.Save(&conflict).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, conflict)
+}
+
+// keepRemote sets the conflicting field of item to the provider's value from the last sync
+func keepRemote(t base.MediaType, conflict Conflict, media *base.BaseMedia) error {
+	f, ok := findSyncField(conflict.Field)
+	if !ok || media.SyncBase == nil {
+		return errors.New("no synced value of " + conflict.Field + " to restore")
+	}
+
+	old := *media
+	remote := media.SyncBase.Media()
+	f.set(media, &remote)
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(t.Table).Model(media).Update(f.name, f.get(media)).Error; err != nil {
+			return err
+		}
+		// a push queued before the sync would overwrite the value just taken from the provider
+		if err := push.Reconcile(tx, media.Username, conflict.MediaType, []base.BaseMedia{*media}); err != nil {
+			return err
+		}
+		if event := base.NewProgressEvent(conflict.MediaType, old, *media, base.SourceManual); event != nil {
+			return tx.Create(event).Error
+		}
+		return nil
+	})
+}
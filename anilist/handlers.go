@@ -4,374 +4,778 @@ import (
 	"errors"
 	"strconv"
 
+	"everythingtracker/auth"
+	"everythingtracker/base"
 	"everythingtracker/db"
+	"everythingtracker/provider"
+	"everythingtracker/push"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// itemColumns are the columns written when a user creates or replaces an item
+var itemColumns = []string{"title", "status", "progress_current", "progress_total", "progress_unit", "seasons", "authors", "score", "repeat_count", "notes", "tags", "started_at", "completed_at", "origin", "updated_at"}
+
+// syncColumns are the columns written by a provider sync, local-only fields such as tags and the origin are kept
+// The snapshot of the provider's copy is only written here
+var syncColumns = []string{"title", "status", "progress_current", "progress_total", "progress_unit", "score", "repeat_count", "notes", "started_at", "completed_at", "sync_base", "updated_at"}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-type SyncResponse struct {
-	Message string `json:"message"`
-	Count   int    `json:"count"`
+// ItemRequest creates or replaces an item
+// ExternalKey gives the external ID in the notation of the media type instead, such as an ISBN with dashes for books
+type ItemRequest struct {
+	base.BaseMedia
+	ExternalKey string `json:"external_key"`
 }
 
-// GetAnimeHandler godoc
-// @Summary Get all anime items for a user
-// @Description Returns all anime items for the specified user.
-// @Tags items
-// @Produce json
-// @Param username query string true "Username to filter anime items"
-// @Success 200 {array} Anime
-// @Failure 400 {object} ErrorResponse
-// @Router /items/anime [get]
-// GetAnimeHandler handles GET requests for anime items
-func GetAnimeHandler(c *gin.Context) {
-	username := c.Query("username")
-	if username == "" {
-		c.JSON(400, gin.H{"error": "username query parameter is required"})
-		return
+// ProgressRequest sets the progress of an item either relative to its current value or absolutely
+// With a season the value is an episode of that season instead of the whole series
+type ProgressRequest struct {
+	Delta  *float64 `json:"delta"`
+	Value  *float64 `json:"value"`
+	Season *int     `json:"season"`
+}
+
+// LinkRequest names the catalog item a custom entry is linked to
+// The provider defaults to the first provider cataloging the media type, ExternalKey works as for ItemRequest
+type LinkRequest struct {
+	Provider    string `json:"provider"`
+	ExternalID  int    `json:"external_id"`
+	ExternalKey string `json:"external_key"`
+}
+
+// ProgressResponse carries the updated item, the status change and for items with seasons the season and episode reached
+type ProgressResponse struct {
+	Item       any                    `json:"item"`
+	Transition *base.StatusTransition `json:"transition"`
+	Season     int                    `json:"season,omitempty"`
+	Episode    float64                `json:"episode,omitempty"`
+}
+
+// mediaTypeParam resolves the type path parameter
+// It writes a 404 response and returns false when no media type is registered under it
+func mediaTypeParam(c *gin.Context) (base.MediaType, bool) {
+	t, ok := base.LookupMediaType(c.Param("type"))
+	if !ok {
+		c.JSON(404, gin.H{"error": "unknown media type: " + c.Param("type")})
 	}
+	return t, ok
+}
 
-	var items []Anime
-	db.DB.Where("username = ?", username).Find(&items)
-	c.JSON(200, items)
+// parseItemKey reads the username and provider query parameters and the external_id path parameter
+// The username defaults to the caller and the provider to the default of t
+// It writes an error response and returns false when a parameter is invalid
+func parseItemKey(c *gin.Context, t base.MediaType) (db.ItemKey, bool) {
+	key := db.ItemKey{Provider: c.DefaultQuery("provider", t.DefaultProvider())}
+
+	var ok bool
+	if key.Username, ok = auth.Username(c, c.Query("username")); !ok {
+		return key, false
+	}
+
+	var err error
+	if key.ExternalID, err = t.ParseExternalID(key.Provider, c.Param("external_id")); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return key, false
+	}
+
+	return key, true
+}
+
+// recordManualChange stores the progress history of a local edit within tx and queues it for pushing to AniList
+func recordManualChange(tx *gorm.DB, mediaType string, old, new base.BaseMedia) error {
+	if err := db.RecordProgress(tx, base.NewProgressEvent(mediaType, old, new, base.SourceManual)); err != nil {
+		return err
+	}
+	return push.Enqueue(tx, mediaType, old, new)
+}
+
+// validateMedia checks that the status is allowed for t, progress values are consistent with each other and the score is in range
+func validateMedia(t base.MediaType, media base.BaseMedia) error {
+	if !t.Allows(media.Status) {
+		return errors.New("status " + string(media.Status) + " is not allowed for " + t.Name)
+	}
+	if media.ProgressUnit != "" && !t.AllowsUnit(media.ProgressUnit) {
+		return errors.New("progress unit " + media.ProgressUnit + " is not allowed for " + t.Name)
+	}
+	if media.ProgressCurrent < 0 {
+		return errors.New("progress_current cannot be negative")
+	}
+	if media.ProgressTotal < 0 {
+		return errors.New("progress_total cannot be negative")
+	}
+	if media.ProgressTotal > 0 && media.ProgressCurrent > media.ProgressTotal {
+		return errors.New("progress_current cannot exceed progress_total (" + strconv.FormatFloat(media.ProgressTotal, 'f', 0, 64) + " " + media.ProgressUnit + ")")
+	}
+	if media.Score < 0 || media.Score > 100 {
+		return errors.New("score must be between 0 and 100")
+	}
+	return nil
 }
 
-// GetMangaHandler godoc
-// @Summary Get all manga items for a user
-// @Description Returns all manga items for the specified user.
+// findItem loads the item identified by key from the table of t
+// It writes an error response and returns false when it doesn't exist or can't be loaded
+func findItem(c *gin.Context, t base.MediaType, key db.ItemKey) (*base.BaseMedia, bool) {
+	var item base.BaseMedia
+	err := db.DB.Table(t.Table).Scopes(key.Scope).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": t.Name + " item not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &item, true
+}
+
+// GetItemsHandler godoc
+// @Summary Get all items of a media type for a user
+// @Description Returns the items of the media type for the specified user, optionally filtered, sorted and paginated.
+// @Description The total number of matching items is returned in X-Total-Count and the next page in a Link header.
 // @Tags items
 // @Produce json
-// @Param username query string true "Username to filter manga items"
-// @Success 200 {array} Manga
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param username query string false "Username to filter items, defaults to the caller"
+// @Param provider query string false "Only return items from this metadata provider"
+// @Param status query []string false "Only return items with these statuses" collectionFormat(multi)
+// @Param title query string false "Only return items whose title contains this text"
+// @Param progress_min query number false "Minimum progress_current"
+// @Param progress_max query number false "Maximum progress_current"
+// @Param updated_since query string false "Only return items updated at or after this RFC3339 timestamp"
+// @Param tag query []string false "Only return items carrying all of these tags" collectionFormat(multi)
+// @Param score_min query number false "Minimum score"
+// @Param score_max query number false "Maximum score"
+// @Param sort query string false "Sort key" Enums(title, updated_at, progress, score)
+// @Param order query string false "Sort order" Enums(asc, desc) default(asc)
+// @Param limit query int false "Page size, 0 returns all items" default(0)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Success 200 {array} base.BaseMedia
+// @Header 200 {integer} X-Total-Count "Total number of matching items"
+// @Header 200 {string} Link "Link to the next page"
 // @Failure 400 {object} ErrorResponse
-// @Router /items/manga [get]
-// GetMangaHandler handles GET requests for manga items
-func GetMangaHandler(c *gin.Context) {
-	username := c.Query("username")
-	if username == "" {
-		c.JSON(400, gin.H{"error": "username query parameter is required"})
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /items/{type} [get]
+// GetItemsHandler handles GET requests for the items of a media type
+func GetItemsHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	q, ok := parseMediaQuery(c)
+	if !ok {
 		return
 	}
 
-	var items []Manga
-	db.DB.Where("username = ?", username).Find(&items)
+	items, total, err := db.ListMedia(t.Table, q)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	setPageHeaders(c, q, total)
 	c.JSON(200, items)
 }
 
-// PostAnimeHandler godoc
-// @Summary Create or update an anime item
-// @Description Upserts an anime item using username and external_id as the unique key.
+// PostItemHandler godoc
+// @Summary Create or update an item
+// @Description Upserts an item of the media type using username, provider and external_id as the unique key.
+// @Description Title and progress unit are taken from the provider, which defaults to the first provider of the media type.
+// @Description Another unit of the media type may be picked with progress_unit, percent always has a total of 100.
+// @Description Custom entries missing from every catalog are entered by hand with provider manual, a title and optionally a total, unit and status,
+// @Description which defaults to the planned status of the media type such as Backlog.
+// @Description They get a generated external_id unless one is given and can later be linked to a provider with POST /items/{type}/{external_id}/link.
 // @Tags items
 // @Accept json
 // @Produce json
-// @Param item body Anime true "Anime item payload (must include username)"
-// @Success 201 {object} Anime
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param item body ItemRequest true "Item payload, username defaults to the caller"
+// @Success 201 {object} base.BaseMedia
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /items/anime [post]
-// PostAnimeHandler handles POST requests for anime items
-func PostAnimeHandler(c *gin.Context) {
-	var item Anime
-	if err := c.ShouldBindJSON(&item); err != nil {
+// @Security BearerAuth
+// @Router /items/{type} [post]
+// PostItemHandler handles POST requests for items
+func PostItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+
+	var req ItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	item := req.BaseMedia
 
-	if item.Username == "" {
-		c.JSON(400, gin.H{"error": "username is required"})
+	if item.Username, ok = auth.Username(c, item.Username); !ok {
 		return
 	}
 
-	if item.ExternalID == 0 {
+	if item.Provider == "" {
+		item.Provider = t.DefaultProvider()
+	}
+	if item.ExternalID, ok = parseExternalKey(c, t, item.Provider, item.ExternalID, req.ExternalKey); !ok {
+		return
+	}
+	if item.ExternalID == 0 && item.Provider != base.ManualProvider {
 		c.JSON(400, gin.H{"error": "external_id is required"})
 		return
 	}
 
-	// Fetch anime data from AniList using external ID
-	anilistData, err := GetAnimeByExternalID(item.ExternalID)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to fetch anime from AniList: " + err.Error()})
+	// items added by hand are never pruned by a sync
+	item.Origin = base.SourceManual
+	if item.Provider == base.ManualProvider {
+		if !fillManual(c, t, &item) {
+			return
+		}
+	} else if !fillFromProvider(c, t, &item) {
 		return
 	}
 
-	// Override title and progress unit with AniList data
-	item.Title = anilistData.Title
-	item.ProgressUnit = anilistData.ProgressUnit
-
-	if anilistData.ProgressTotal == 0 {
-		// AniList doesn't know total episodes, use user-supplied values for both
-		// item.ProgressCurrent and item.ProgressTotal already set from JSON
-		item.ProgressTotal = item.ProgressCurrent
+	if err := validateMedia(t, item); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Validate that user's progress is non-negative
-		if item.ProgressCurrent < 0 {
-			c.JSON(400, gin.H{"error": "progress_current cannot be negative"})
+	if item.ExternalID == 0 {
+		// custom entries without an ID are always new
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := db.CreateWithNewID(tx, t.Table, &item); err != nil {
+				return err
+			}
+			return recordManualChange(tx, t.Name, base.BaseMedia{}, item)
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-	} else {
-		// AniList knows total episodes, use it
-		item.ProgressTotal = anilistData.ProgressTotal
 
-		// Validate that user's progress doesn't exceed total
-		if item.ProgressCurrent > item.ProgressTotal {
-			c.JSON(400, gin.H{"error": "progress_current cannot exceed progress_total (" + strconv.FormatFloat(item.ProgressTotal, 'f', 0, 64) + " episodes)"})
+		// fetch the created item to return in response
+		if err := db.DB.Table(t.Table).First(&item, item.ID).Error; err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(201, item)
+		return
 	}
 
-	// upsert logic
-	err = db.UpsertMedia(&item, []string{"title", "status", "progress_current", "progress_total", "progress_unit", "updated_at"})
+	key := db.ItemKey{Username: item.Username, Provider: item.Provider, ExternalID: item.ExternalID}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// remember the previous state for the progress history
+		var existing base.BaseMedia
+		if err := tx.Table(t.Table).Scopes(key.Scope).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		if err := db.UpsertMedia(tx, t.Table, &item, itemColumns); err != nil {
+			return err
+		}
+		return recordManualChange(tx, t.Name, existing, item)
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
 	// fetch the updated or created item to return in response
-	db.DB.Where("username = ? AND external_id = ?", item.Username, item.ExternalID).First(&item)
+	if err := db.DB.Table(t.Table).Scopes(key.Scope).First(&item).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(201, item)
 }
 
-// PostMangaHandler godoc
-// @Summary Create or update a manga item
-// @Description Upserts a manga item using username and external_id as the unique key.
-// @Tags items
-// @Accept json
-// @Produce json
-// @Param item body Manga true "Manga item payload (must include username)"
-// @Success 201 {object} Manga
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /items/manga [post]
-// PostMangaHandler handles POST requests for manga items
-func PostMangaHandler(c *gin.Context) {
-	var item Manga
-	if err := c.ShouldBindJSON(&item); err != nil {
+// parseExternalKey returns the external ID of an item of provider given either as id or as key in the notation of t
+// Numeric IDs are normalized the same way, it writes a 400 response and returns false when the ID is invalid
+func parseExternalKey(c *gin.Context, t base.MediaType, provider string, id int, key string) (int, bool) {
+	if key == "" && id != 0 && t.ParseID != nil {
+		key = strconv.Itoa(id)
+	}
+	if key == "" {
+		return id, true
+	}
+	id, err := t.ParseExternalID(provider, key)
+	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
-		return
+		return 0, false
 	}
+	return id, true
+}
 
-	if item.Username == "" {
-		c.JSON(400, gin.H{"error": "username is required"})
-		return
+// fillManual checks an item entered by hand, which keeps the title, total and unit given by the user and starts out planned without a status
+// It writes a 400 response and returns false when a value is missing
+func fillManual(c *gin.Context, t base.MediaType, item *base.BaseMedia) bool {
+	if item.Title == "" {
+		c.JSON(400, gin.H{"error": "title is required for items entered by hand"})
+		return false
+	}
+	if item.ProgressUnit == "" {
+		item.ProgressUnit = t.ProgressUnit
+	}
+	if item.ProgressUnit == base.PercentUnit {
+		item.ProgressTotal = 100
 	}
+	if item.Status == "" {
+		item.Status = t.Planned()
+	}
+	return true
+}
 
-	if item.ExternalID == 0 {
-		c.JSON(400, gin.H{"error": "external_id is required"})
-		return
+// fillFromProvider looks an item up at its provider and takes its title, authors, seasons, unit and total
+// It writes an error response and returns false when the lookup fails or the user's values don't fit
+func fillFromProvider(c *gin.Context, t base.MediaType, item *base.BaseMedia) bool {
+	p, err := provider.Get(item.Provider)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error() + ": " + item.Provider})
+		return false
 	}
 
-	// Fetch manga data from AniList using external ID
-	anilistData, err := GetMangaByExternalID(item.ExternalID)
+	// Fetch the item's data from the provider using external ID
+	providerData, err := p.Lookup(t.Name, item.ExternalID)
+	if errors.Is(err, provider.ErrUnsupportedMediaType) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to fetch manga from AniList: " + err.Error()})
-		return
+		c.JSON(500, gin.H{"error": "Failed to fetch " + t.Name + " from " + p.Name() + ": " + err.Error()})
+		return false
 	}
 
-	// Override title and progress unit with AniList data
-	item.Title = anilistData.Title
-	item.ProgressUnit = anilistData.ProgressUnit
+	// Override title, authors, seasons and progress unit with provider data unless the user picked another unit
+	item.Title = providerData.Title
+	item.Authors = providerData.Authors
+	item.Seasons = providerData.Seasons
+	unit := item.ProgressUnit
+	item.ProgressUnit = providerData.ProgressUnit
+	if item.ProgressUnit == "" {
+		item.ProgressUnit = t.ProgressUnit
+	}
+	if unit != "" && unit != item.ProgressUnit {
+		if !t.AllowsUnit(unit) {
+			c.JSON(400, gin.H{"error": "progress unit " + unit + " is not allowed for " + t.Name})
+			return false
+		}
+		// the provider's total is counted in its own unit
+		item.ProgressUnit, item.Seasons = unit, nil
+		providerData.ProgressTotal = 0
+		if unit == base.PercentUnit {
+			providerData.ProgressTotal = 100
+		}
+	}
 
-	if anilistData.ProgressTotal == 0 {
-		// AniList doesn't know total chapters, use user-supplied values for both
-		// item.ProgressCurrent and item.ProgressTotal already set from JSON
-		item.ProgressTotal = item.ProgressCurrent
+	if providerData.ProgressTotal == 0 {
+		// The provider doesn't know the total, use user-supplied values for both
+		// item.ProgressCurrent and item.ProgressTotal already set from JSON, a zero total stays unknown
 
 		// Validate that user's progress is non-negative
 		if item.ProgressCurrent < 0 {
 			c.JSON(400, gin.H{"error": "progress_current cannot be negative"})
-			return
+			return false
 		}
 	} else {
-		// AniList knows total chapters, use it
-		item.ProgressTotal = anilistData.ProgressTotal
+		// The provider knows the total, use it
+		item.ProgressTotal = providerData.ProgressTotal
 
 		// Validate that user's progress doesn't exceed total
 		if item.ProgressCurrent > item.ProgressTotal {
-			c.JSON(400, gin.H{"error": "progress_current cannot exceed progress_total (" + strconv.FormatFloat(item.ProgressTotal, 'f', 0, 64) + " chapters)"})
-			return
+			c.JSON(400, gin.H{"error": "progress_current cannot exceed progress_total (" + strconv.FormatFloat(item.ProgressTotal, 'f', 0, 64) + " " + item.ProgressUnit + ")"})
+			return false
 		}
 	}
 
-	// upsert logic
-	err = db.UpsertMedia(&item, []string{"title", "status", "progress_current", "progress_total", "progress_unit", "updated_at"})
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+	return true
+}
+
+// GetItemHandler godoc
+// @Summary Get a single item
+// @Description Returns the item of the media type identified by username, provider and external_id.
+// @Tags items
+// @Produce json
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Success 200 {object} base.BaseMedia
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /items/{type}/{external_id} [get]
+// GetItemHandler handles GET requests for a single item
+func GetItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
 		return
 	}
 
-	// fetch the updated or created item to return in response
-	db.DB.Where("username = ? AND external_id = ?", item.Username, item.ExternalID).First(&item)
+	item, ok := findItem(c, t, key)
+	if !ok {
+		return
+	}
 
-	c.JSON(201, item)
+	c.JSON(200, item)
 }
 
-// SyncAnimeHandler godoc
-// @Summary Sync anime from AniList
-// @Description Fetches a user's anime list from AniList and upserts all entries into the local database.
-// @Tags sync
+// PatchItemHandler godoc
+// @Summary Partially update an item
+// @Description Updates only the fields present in the payload for the item identified by username, provider and external_id.
+// @Tags items
+// @Accept json
 // @Produce json
-// @Param username query string true "AniList username"
-// @Success 200 {object} SyncResponse
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Param patch body base.MediaPatch true "Fields to update"
+// @Success 200 {object} base.BaseMedia
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /sync/anilist/anime [post]
-// SyncAnimeHandler handles anime sync requests from AniList
-func SyncAnimeHandler(c *gin.Context) {
-	username := c.Query("username")
-	if username == "" {
-		c.JSON(400, gin.H{"error": "username query parameter is required"})
+// @Security BearerAuth
+// @Router /items/{type}/{external_id} [patch]
+// PatchItemHandler handles PATCH requests for a single item
+func PatchItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
 		return
 	}
 
-	data, err := FetchAniListAnime(username)
-	if err != nil {
-		c.JSON(500, gin.H{
-			"error":   err.Error(),
-			"message": "Failed to fetch anime list from AniList. Please verify the username exists and the anime list is set to public.",
-		})
+	var patch base.MediaPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	for i := range data {
-		data[i].Username = username
+	item, ok := findItem(c, t, key)
+	if !ok {
+		return
+	}
 
-		var existing Anime
-		err := db.DB.Where("username = ? AND external_id = ?", username, data[i].ExternalID).First(&existing).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
+	old := *item
+	updates := patch.Apply(item)
+	if err := validateMedia(t, *item); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			if err := db.DB.Create(&data[i]).Error; err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Table(t.Table).Model(item).Updates(updates).Error; err != nil {
+				return err
 			}
-			continue
-		}
-
-		if !data[i].UpdatedAt.After(existing.UpdatedAt) {
-			continue
 		}
+		return recordManualChange(tx, t.Name, old, *item)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
 
-		err = db.UpsertMedia(&data[i], []string{"title", "status", "progress_current", "progress_total", "progress_unit", "updated_at"})
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
+	if err := db.DB.Table(t.Table).First(item, item.ID).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(200, gin.H{"message": "Sync Complete", "count": len(data)})
+	c.JSON(200, item)
 }
 
-// SyncMangaHandler godoc
-// @Summary Sync manga from AniList
-// @Description Fetches a user's manga list from AniList and upserts all entries into the local database.
-// @Tags sync
+// ProgressItemHandler godoc
+// @Summary Update the progress of an item
+// @Description Changes progress_current by a delta or to an absolute value and moves the status along: planned items
+// @Description become active (Watching, Reading, ...) once progress starts and items reaching progress_total become finished
+// @Description (Completed, for games Beaten or 100% Completed when tracked in percent). Finished items whose progress goes back are started again as Rewatching
+// @Description or Rereading, and finishing those counts another repeat in repeat_count.
+// @Description For series with seasons a value can be given as an episode of a season, the response then names the season and episode reached.
+// @Tags items
+// @Accept json
 // @Produce json
-// @Param username query string true "AniList username"
-// @Success 200 {object} SyncResponse
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Param progress body ProgressRequest true "Either delta or value, optionally with a season"
+// @Success 200 {object} ProgressResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /sync/anilist/manga [post]
-// SyncMangaHandler handles manga sync requests from AniList
-func SyncMangaHandler(c *gin.Context) {
-	username := c.Query("username")
-	if username == "" {
-		c.JSON(400, gin.H{"error": "username query parameter is required"})
+// @Security BearerAuth
+// @Router /items/{type}/{external_id}/progress [post]
+// ProgressItemHandler handles progress updates for items
+func ProgressItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
 		return
 	}
 
-	data, err := FetchAniListManga(username)
-	if err != nil {
-		c.JSON(500, gin.H{
-			"error":   err.Error(),
-			"message": "Failed to fetch manga list from AniList. Please verify the username exists and the manga list is set to public.",
-		})
+	var req ProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Delta == nil) == (req.Value == nil) {
+		c.JSON(400, gin.H{"error": "exactly one of delta or value is required"})
+		return
+	}
+	if req.Season != nil && req.Value == nil {
+		c.JSON(400, gin.H{"error": "season requires value"})
 		return
 	}
 
-	for i := range data {
-		data[i].Username = username
+	item, ok := findItem(c, t, key)
+	if !ok {
+		return
+	}
 
-		var existing Manga
-		err := db.DB.Where("username = ? AND external_id = ?", username, data[i].ExternalID).First(&existing).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(500, gin.H{"error": err.Error()})
+	old := *item
+	value := item.ProgressCurrent
+	switch {
+	case req.Delta != nil:
+		value += *req.Delta
+	case req.Season != nil:
+		var err error
+		if value, err = item.EpisodeOf(*req.Season, *req.Value); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+	default:
+		value = *req.Value
+	}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			if err := db.DB.Create(&data[i]).Error; err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			continue
-		}
-
-		if !data[i].UpdatedAt.After(existing.UpdatedAt) {
-			continue
-		}
+	transition := item.SetProgress(value, t)
+	if err := validateMedia(t, *item); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-		err = db.UpsertMedia(&data[i], []string{"title", "status", "progress_current", "progress_total", "progress_unit", "updated_at"})
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(t.Table).Model(item).Updates(map[string]any{
+			"progress_current": item.ProgressCurrent,
+			"status":           item.Status,
+			"repeat_count":     item.RepeatCount,
+		}).Error
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+			return err
 		}
+		return recordManualChange(tx, t.Name, old, *item)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(200, gin.H{"message": "Sync Complete", "count": len(data)})
+	res := ProgressResponse{Item: item, Transition: transition}
+	res.Season, res.Episode = item.SeasonOf(item.ProgressCurrent)
+	c.JSON(200, res)
 }
 
-// SearchAnimeHandler godoc
-// @Summary Search AniList anime
-// @Description Searches AniList anime by query string.
-// @Tags search
+// DeleteItemHandler godoc
+// @Summary Delete an item
+// @Description Soft-deletes the item of the media type identified by username, provider and external_id.
+// @Tags items
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /items/{type}/{external_id} [delete]
+// DeleteItemHandler handles DELETE requests for a single item
+func DeleteItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
+		return
+	}
+
+	res := db.DB.Table(t.Table).Scopes(key.Scope).Delete(&base.BaseMedia{})
+	if res.Error != nil {
+		c.JSON(500, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": t.Name + " item not found"})
+		return
+	}
+
+	c.Status(204)
+}
+
+// linkColumns are the columns taken from the provider when a custom entry is linked
+var linkColumns = []string{"title", "authors", "seasons", "progress_unit", "progress_total", "updated_at"}
+
+// LinkItemHandler godoc
+// @Summary Link a custom entry to a provider
+// @Description Attaches a custom entry, entered by hand with provider manual, to an item of a provider such as an AniList ID.
+// @Description Title, authors, seasons, unit and total are taken from the provider like for a new item, while status, progress,
+// @Description score, notes and tags are kept and the progress history moves along. Percent progress stays percent.
+// @Tags items
+// @Accept json
 // @Produce json
-// @Param query query string true "Search query"
-// @Param search_count query int false "Maximum number of results" default(10)
-// @Success 200 {array} Anime
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "Generated external ID of the custom entry"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param link body LinkRequest true "Provider item to link to"
+// @Success 200 {object} base.BaseMedia
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /search/anilist/anime [get]
-// SearchAnimeHandler handles search requests for AniList anime
-func SearchAnimeHandler(c *gin.Context) {
-	query := c.Query("query")
-	searchCount, _ := strconv.Atoi(c.DefaultQuery("search_count", "10"))
+// @Security BearerAuth
+// @Router /items/{type}/{external_id}/link [post]
+// LinkItemHandler handles linking custom entries to a provider
+func LinkItemHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
 
-	if query == "" {
-		c.JSON(400, gin.H{"error": "query parameter is required"})
+	from := db.ItemKey{Provider: base.ManualProvider}
+	if from.Username, ok = auth.Username(c, c.Query("username")); !ok {
+		return
+	}
+	var err error
+	if from.ExternalID, err = t.ParseExternalID(base.ManualProvider, c.Param("external_id")); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req LinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Provider == "" {
+		req.Provider = t.CatalogProvider()
+	}
+	if req.Provider == "" || req.Provider == base.ManualProvider {
+		c.JSON(400, gin.H{"error": "provider must name a catalog of " + t.Name})
+		return
+	}
+	externalID, ok := parseExternalKey(c, t, req.Provider, req.ExternalID, req.ExternalKey)
+	if !ok {
+		return
+	}
+	if externalID == 0 {
+		c.JSON(400, gin.H{"error": "external_id is required"})
+		return
+	}
+
+	item, ok := findItem(c, t, from)
+	if !ok {
 		return
 	}
 
-	results, err := SearchAnilistAnime(query, searchCount)
+	item.Provider, item.ExternalID = req.Provider, externalID
+	if !fillFromProvider(c, t, item) {
+		return
+	}
+	if err := validateMedia(t, *item); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = db.LinkMedia(t.Table, t.Name, item, from, linkColumns)
+	if errors.Is(err, db.ErrActiveExists) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, results)
+	// the provider has never seen the entry, so it is pushed as a whole
+	if err := push.Enqueue(db.DB, t.Name, base.BaseMedia{}, *item); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.DB.Table(t.Table).First(item, item.ID).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, item)
 }
 
-// SearchMangaHandler godoc
-// @Summary Search AniList manga
-// @Description Searches AniList manga by query string.
+// MediaTypesHandler godoc
+// @Summary List media types
+// @Description Returns the registered media types with their progress unit, allowed statuses and providers.
+// @Tags items
+// @Produce json
+// @Success 200 {array} base.MediaType
+// @Router /types [get]
+// MediaTypesHandler handles requests for the registered media types
+func MediaTypesHandler(c *gin.Context) {
+	c.JSON(200, base.MediaTypes())
+}
+
+// parseProviderRoute resolves the provider and media type path parameters
+// It writes a 404 response and returns false when either is unknown
+func parseProviderRoute(c *gin.Context) (provider.Provider, string, bool) {
+	p, err := provider.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error() + ": " + c.Param("provider")})
+		return nil, "", false
+	}
+
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return nil, "", false
+	}
+
+	return p, t.Name, true
+}
+
+// SearchHandler godoc
+// @Summary Search a provider
+// @Description Searches the provider's catalog of the given media type by query string.
 // @Tags search
 // @Produce json
+// @Param provider path string true "Metadata provider" default(anilist)
+// @Param type path string true "Media type, see GET /types" default(anime)
 // @Param query query string true "Search query"
 // @Param search_count query int false "Maximum number of results" default(10)
-// @Success 200 {array} Manga
+// @Success 200 {array} base.BaseMedia
 // @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /search/anilist/manga [get]
-// SearchMangaHandler handles search requests for AniList manga
-func SearchMangaHandler(c *gin.Context) {
+// @Router /search/{provider}/{type} [get]
+// SearchHandler handles search requests for any registered provider
+func SearchHandler(c *gin.Context) {
+	p, mediaType, ok := parseProviderRoute(c)
+	if !ok {
+		return
+	}
+
 	query := c.Query("query")
 	searchCount, _ := strconv.Atoi(c.DefaultQuery("search_count", "10"))
 
@@ -380,7 +784,11 @@ func SearchMangaHandler(c *gin.Context) {
 		return
 	}
 
-	results, err := SearchAnilistManga(query, searchCount)
+	results, err := p.Search(mediaType, query, searchCount)
+	if errors.Is(err, provider.ErrUnsupportedMediaType) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
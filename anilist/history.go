@@ -0,0 +1,88 @@
+package anilist
+
+import (
+	"strconv"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ItemHistoryHandler godoc
+// @Summary Get the progress history of an item
+// @Description Returns every recorded progress and status change of the item, newest first.
+// @Tags history
+// @Produce json
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Success 200 {array} base.ProgressEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /items/{type}/{external_id}/history [get]
+// ItemHistoryHandler handles progress history requests for items
+func ItemHistoryHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
+		return
+	}
+
+	events, err := db.ItemHistory(key, t.Name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, events)
+}
+
+// ActivityHandler godoc
+// @Summary Get a user's activity timeline
+// @Description Returns the most recent progress and status changes of a user across all media types, newest first.
+// @Tags history
+// @Produce json
+// @Param username query string false "Username to get the activity of, defaults to the caller"
+// @Param since query string false "Only return events at or after this RFC3339 timestamp"
+// @Param limit query int false "Maximum number of events, 0 returns all" default(50)
+// @Success 200 {array} base.ProgressEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /activity [get]
+// ActivityHandler handles activity timeline requests
+func ActivityHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 0 {
+		c.JSON(400, gin.H{"error": "limit must be a non-negative integer"})
+		return
+	}
+
+	var since time.Time
+	if raw := c.Query("since"); raw != "" {
+		since, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "since must be an RFC3339 timestamp"})
+			return
+		}
+	}
+
+	events, err := db.UserActivity(username, since, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, events)
+}
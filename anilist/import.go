@@ -0,0 +1,276 @@
+package anilist
+
+import (
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/goodreads"
+	"everythingtracker/mal"
+	"everythingtracker/openlibrary"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImportIssue describes an export row that was not imported
+type ImportIssue struct {
+	MalID       int    `json:"mal_id,omitempty"`
+	GoodreadsID int    `json:"goodreads_id,omitempty"`
+	Title       string `json:"title"`
+	Reason      string `json:"reason"`
+}
+
+type ImportReport struct {
+	MediaType string        `json:"media_type"`
+	Imported  int           `json:"imported"`
+	Skipped   []ImportIssue `json:"skipped"`
+	Unmatched []ImportIssue `json:"unmatched"`
+}
+
+// ImportMALHandler godoc
+// @Summary Import a MyAnimeList export
+// @Description Imports an animelist.xml or mangalist.xml export from MyAnimeList. MyAnimeList IDs are mapped to
+// @Description AniList IDs through AniList's idMal lookup, or through the offline mapping table when mapping=offline.
+// @Tags import
+// @Accept multipart/form-data
+// @Produce json
+// @Param username formData string false "Username to import the list for, defaults to the caller"
+// @Param file formData file true "MyAnimeList XML export"
+// @Param mapping formData string false "How to map MyAnimeList IDs" Enums(anilist, offline) default(anilist)
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /import/mal [post]
+// ImportMALHandler handles MyAnimeList XML imports
+func ImportMALHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.PostForm("username"))
+	if !ok {
+		return
+	}
+
+	mapping := c.DefaultPostForm("mapping", "anilist")
+	if mapping != "anilist" && mapping != "offline" {
+		c.JSON(400, gin.H{"error": "mapping must be anilist or offline"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	mediaType, entries, err := mal.Parse(file)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// resolve MyAnimeList IDs to AniList media
+	resolved := map[int]base.BaseMedia{}
+	if mapping == "offline" {
+		for _, entry := range entries {
+			if id, ok := mal.IDMap.Lookup(mediaType, entry.MalID); ok {
+				resolved[entry.MalID] = base.BaseMedia{Title: entry.Title, Provider: Provider{}.Name(), ExternalID: id, ProgressTotal: entry.Total}
+			}
+		}
+	} else {
+		ids := make([]int, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.MalID
+		}
+		resolved, err = ResolveMalIDs(mediaType, ids)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to map MyAnimeList IDs through AniList: " + err.Error()})
+			return
+		}
+	}
+
+	t, ok := base.LookupMediaType(mediaType)
+	if !ok {
+		c.JSON(500, gin.H{"error": "unknown media type: " + mediaType})
+		return
+	}
+
+	report := ImportReport{MediaType: mediaType, Skipped: []ImportIssue{}, Unmatched: []ImportIssue{}}
+	isAnime := mediaType == MediaTypeAnime
+	var items []base.BaseMedia
+
+	for _, entry := range entries {
+		media, ok := resolved[entry.MalID]
+		if !ok {
+			report.Unmatched = append(report.Unmatched, ImportIssue{MalID: entry.MalID, Title: entry.Title, Reason: "no AniList ID for this MyAnimeList ID"})
+			continue
+		}
+
+		status, err := mal.MapStatus(entry.Status, isAnime)
+		if err != nil {
+			report.Skipped = append(report.Skipped, ImportIssue{MalID: entry.MalID, Title: entry.Title, Reason: err.Error()})
+			continue
+		}
+
+		media.Username = username
+		media.Origin = base.SourceImport
+		media.Status = status
+		media.ProgressCurrent = entry.Progress
+		if media.ProgressTotal == 0 {
+			media.ProgressTotal = entry.Total
+		}
+		media.ProgressUnit = t.ProgressUnit
+		media.Score = entry.Score * 10
+		media.RepeatCount = entry.Repeat
+		media.Notes = entry.Notes
+		media.Tags = entry.Tags
+		media.StartedAt = entry.StartedAt
+		media.CompletedAt = entry.CompletedAt
+
+		if err := validateMedia(t, media); err != nil {
+			report.Skipped = append(report.Skipped, ImportIssue{MalID: entry.MalID, Title: entry.Title, Reason: err.Error()})
+			continue
+		}
+		items = append(items, media)
+	}
+
+	if err := importMedia(t, items); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	report.Imported = len(items)
+
+	c.JSON(200, report)
+}
+
+// importMedia upserts imported items and records the changes in the progress history, all or none of them
+func importMedia(t base.MediaType, items []base.BaseMedia) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, media := range items {
+			key := db.ItemKey{Username: media.Username, Provider: media.Provider, ExternalID: media.ExternalID}
+			var existing base.BaseMedia
+			if err := tx.Table(t.Table).Scopes(key.Scope).Limit(1).Find(&existing).Error; err != nil {
+				return err
+			}
+
+			item := media
+			if err := db.UpsertMedia(tx, t.Table, &item, itemColumns); err != nil {
+				return err
+			}
+			if err := db.RecordProgress(tx, base.NewProgressEvent(t.Name, existing, media, base.SourceImport)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportGoodreadsHandler godoc
+// @Summary Import a Goodreads export
+// @Description Imports the library CSV export of a Goodreads account into the books. Books are identified by their ISBN,
+// @Description rows without a valid one are reported as unmatched. The exclusive shelf sets the status, other shelves become tags.
+// @Tags import
+// @Accept multipart/form-data
+// @Produce json
+// @Param username formData string false "Username to import the list for, defaults to the caller"
+// @Param file formData file true "Goodreads library export CSV"
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /import/goodreads [post]
+// ImportGoodreadsHandler handles Goodreads CSV imports
+func ImportGoodreadsHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.PostForm("username"))
+	if !ok {
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	entries, err := goodreads.Parse(file)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	t, ok := base.LookupMediaType(openlibrary.MediaTypeBook)
+	if !ok {
+		c.JSON(500, gin.H{"error": "unknown media type: " + openlibrary.MediaTypeBook})
+		return
+	}
+
+	report := ImportReport{MediaType: t.Name, Skipped: []ImportIssue{}, Unmatched: []ImportIssue{}}
+	var items []base.BaseMedia
+
+	for _, entry := range entries {
+		issue := ImportIssue{GoodreadsID: entry.BookID, Title: entry.Title}
+		if entry.ISBN == "" {
+			issue.Reason = "no ISBN in the export"
+			report.Unmatched = append(report.Unmatched, issue)
+			continue
+		}
+		isbn, err := openlibrary.ParseISBN(entry.ISBN)
+		if err != nil {
+			issue.Reason = err.Error() + ": " + entry.ISBN
+			report.Unmatched = append(report.Unmatched, issue)
+			continue
+		}
+
+		status, err := goodreads.MapStatus(entry.Shelf)
+		if err != nil {
+			issue.Reason = err.Error()
+			report.Skipped = append(report.Skipped, issue)
+			continue
+		}
+
+		media := base.BaseMedia{
+			Username:      username,
+			Title:         entry.Title,
+			Authors:       entry.Authors,
+			Provider:      openlibrary.Name,
+			ExternalID:    isbn,
+			Status:        status,
+			ProgressTotal: entry.Pages,
+			ProgressUnit:  t.ProgressUnit,
+			Score:         entry.Rating * 20,
+			RepeatCount:   max(entry.ReadCount-1, 0),
+			Notes:         entry.Notes,
+			Tags:          entry.Tags,
+			CompletedAt:   entry.CompletedAt,
+			Origin:        base.SourceImport,
+		}
+		if status == base.StatusCompleted {
+			media.ProgressCurrent = media.ProgressTotal
+		}
+
+		if err := validateMedia(t, media); err != nil {
+			issue.Reason = err.Error()
+			report.Skipped = append(report.Skipped, issue)
+			continue
+		}
+		items = append(items, media)
+	}
+
+	if err := importMedia(t, items); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	report.Imported = len(items)
+
+	c.JSON(200, report)
+}
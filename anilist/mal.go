@@ -0,0 +1,55 @@
+package anilist
+
+import (
+	"everythingtracker/base"
+
+	"github.com/rl404/verniy"
+)
+
+// malBatchSize is the number of MyAnimeList IDs resolved per AniList request
+const malBatchSize = 50
+
+// ResolveMalIDs looks up AniList media by their MyAnimeList IDs
+// The result is keyed by MyAnimeList ID, IDs unknown to AniList are missing from it
+func ResolveMalIDs(mediaType string, malIDs []int) (map[int]base.BaseMedia, error) {
+	v := newClient("")
+	res := map[int]base.BaseMedia{}
+
+	for start := 0; start < len(malIDs); start += malBatchSize {
+		batch := malIDs[start:min(start+malBatchSize, len(malIDs))]
+		params := verniy.PageParamMedia{IDMALIn: batch}
+		title := verniy.MediaFieldTitle(verniy.MediaTitleFieldRomaji, verniy.MediaTitleFieldEnglish)
+
+		var page *verniy.Page
+		var err error
+		if mediaType == MediaTypeManga {
+			page, err = v.SearchManga(params, 1, malBatchSize, verniy.MediaFieldID, verniy.MediaFieldIDMAL, title, verniy.MediaFieldChapters)
+		} else {
+			page, err = v.SearchAnime(params, 1, malBatchSize, verniy.MediaFieldID, verniy.MediaFieldIDMAL, title, verniy.MediaFieldEpisodes)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, media := range page.Media {
+			if media.IDMAL == nil {
+				continue
+			}
+
+			item := base.BaseMedia{
+				Title:      ExtractTitle(media.ID, &media),
+				Provider:   Provider{}.Name(),
+				ExternalID: media.ID,
+			}
+			if media.Episodes != nil {
+				item.ProgressTotal = float64(*media.Episodes)
+			}
+			if media.Chapters != nil {
+				item.ProgressTotal = float64(*media.Chapters)
+			}
+			res[*media.IDMAL] = item
+		}
+	}
+
+	return res, nil
+}
@@ -2,6 +2,7 @@ package anilist
 
 import (
 	"everythingtracker/base"
+	"fmt"
 	"time"
 
 	"github.com/rl404/verniy"
@@ -16,17 +17,27 @@ func (Manga) TableName() string {
 	return "mangas"
 }
 
-func FetchAniListManga(username string) ([]Manga, error) {
-	v := verniy.New()
+// FetchAniListManga fetches the manga list of the AniList user account for the local user username
+// The list is fetched with the token of the user if it belongs to the account, so private lists can be synced
+func FetchAniListManga(username, account string) ([]Manga, error) {
+	v, err := userClient(username, account)
+	if err != nil {
+		return nil, err
+	}
 
 	collection, err := v.GetUserMangaList(
-		username,
+		account,
 		verniy.MediaListGroupFieldName,
 		verniy.MediaListGroupFieldStatus,
 		verniy.MediaListGroupFieldEntries(
 			verniy.MediaListFieldID,
 			verniy.MediaListFieldStatus,
 			verniy.MediaListFieldProgress,
+			MediaListFieldScore100,
+			verniy.MediaListFieldNotes,
+			verniy.MediaListFieldRepeat,
+			verniy.MediaListFieldStartedAt,
+			verniy.MediaListFieldCompletedAt,
 			verniy.MediaListFieldCreatedAt,
 			verniy.MediaListFieldUpdatedAt,
 			verniy.MediaListFieldMedia(
@@ -48,24 +59,51 @@ func FetchAniListManga(username string) ([]Manga, error) {
 
 	for _, list := range collection {
 		for _, entry := range list.Entries {
+			// entries without media can't be keyed, an entry without a status is an incomplete response
+			if entry.Media == nil {
+				continue
+			}
+			if entry.Status == nil {
+				return nil, fmt.Errorf("media id %d: entry has no status", entry.Media.ID)
+			}
+			progress := 0.0
+			if entry.Progress != nil {
+				progress = float64(*entry.Progress)
+			}
+
 			// for ongoing manga, Anilist doesn't track total chapters released, so we set it to chapters read
 			progressTotal := 0.0
 
-			if entry.Media != nil && entry.Media.Chapters != nil {
+			if entry.Media.Chapters != nil {
 				progressTotal = float64(*entry.Media.Chapters)
 			} else {
 				print("No chapter count found for media id ", entry.Media.ID, "\n")
 				print("Using chapters read as fallback for progress_total\n")
-				progressTotal = float64(*entry.Progress)
+				progressTotal = progress
 			}
 
 			item := Manga{}
 			item.Title = ExtractTitle(entry.Media.ID, entry.Media)
 			item.ExternalID = entry.Media.ID
-			item.Status = MapAniListStatus(string(*entry.Status), false)
-			item.ProgressCurrent = float64(*entry.Progress)
+			status, err := MapAniListStatus(string(*entry.Status), false)
+			if err != nil {
+				return nil, fmt.Errorf("media id %d: %w", entry.Media.ID, err)
+			}
+			item.Status = status
+			item.ProgressCurrent = progress
 			item.ProgressTotal = progressTotal
 			item.ProgressUnit = "ch"
+			if entry.Score != nil {
+				item.Score = *entry.Score
+			}
+			if entry.Repeat != nil {
+				item.RepeatCount = *entry.Repeat
+			}
+			if entry.Notes != nil {
+				item.Notes = *entry.Notes
+			}
+			item.StartedAt = FuzzyDateToTime(entry.StartedAt)
+			item.CompletedAt = FuzzyDateToTime(entry.CompletedAt)
 			if entry.CreatedAt != nil {
 				item.CreatedAt = time.Unix(int64(*entry.CreatedAt), 0).UTC()
 			}
@@ -79,7 +117,7 @@ func FetchAniListManga(username string) ([]Manga, error) {
 }
 
 func SearchAnilistManga(query string, searchCount int) ([]Manga, error) {
-	v := verniy.New()
+	v := newClient("")
 
 	searchPage, err := v.SearchManga(verniy.PageParamMedia{Search: query}, 1, searchCount)
 	if err != nil {
@@ -98,7 +136,7 @@ func SearchAnilistManga(query string, searchCount int) ([]Manga, error) {
 }
 
 func GetMangaByExternalID(externalID int) (*Manga, error) {
-	v := verniy.New()
+	v := newClient("")
 
 	media, err := v.GetManga(externalID)
 	if err != nil {
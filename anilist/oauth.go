@@ -0,0 +1,494 @@
+package anilist
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/db"
+	"everythingtracker/push"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// Default AniList OAuth endpoints
+const (
+	DefaultAuthURL  = "https://anilist.co/api/v2/oauth/authorize"
+	DefaultTokenURL = "https://anilist.co/api/v2/oauth/token"
+)
+
+// stateTTL is how long a login may take before its state is rejected
+const stateTTL = 10 * time.Minute
+
+// loginCookie holds the nonce binding a login state to the browser that started the login
+const loginCookie = "anilist_login"
+
+// defaultTokenLifetime is assumed for tokens without an expiry
+const defaultTokenLifetime = 365 * 24 * time.Hour
+
+// OAuthConfig holds the AniList API client used for account linking
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // must match the redirect URL registered for the client
+	AuthURL      string
+	TokenURL     string
+}
+
+// OAuth is the AniList API client used for account linking
+var OAuth = OAuthConfig{AuthURL: DefaultAuthURL, TokenURL: DefaultTokenURL}
+
+// tokenKey encrypts stored access tokens and signs login states
+var tokenKey []byte
+
+// SetTokenKey sets the base64 encoded 32 byte key used to encrypt stored access tokens
+func SetTokenKey(key string) error {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return err
+	}
+	if len(k) != 32 {
+		return errors.New("token key must be 32 bytes")
+	}
+	tokenKey = k
+	return nil
+}
+
+// Token is the encrypted AniList access token of a local user
+type Token struct {
+	ID          uint      `gorm:"primarykey" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Username    string    `gorm:"uniqueIndex" json:"username"`
+	Account     string    `json:"account"` // AniList user name the token belongs to
+	AccessToken []byte    `json:"-"`       // AES-GCM sealed, prefixed with its nonce
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// TableName sets the table name for AniList tokens
+func (Token) TableName() string {
+	return "anilist_tokens"
+}
+
+// encrypt seals plain with tokenKey
+func encrypt(plain string) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, []byte(plain), nil), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func decrypt(sealed []byte) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("stored token is corrupt")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("stored token can't be decrypted, was the token key changed?")
+	}
+	return string(plain), nil
+}
+
+// newGCM returns the AES-GCM cipher for tokenKey
+func newGCM() (cipher.AEAD, error) {
+	if tokenKey == nil {
+		return nil, errors.New("no token key configured")
+	}
+	block, err := aes.NewCipher(tokenKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// UserToken returns the AniList access token of a user, or push.ErrNoToken
+func UserToken(username string) (string, error) {
+	if tokenKey == nil {
+		return "", push.ErrNoToken
+	}
+
+	var t Token
+	if err := db.DB.Where("username = ?", username).Limit(1).Find(&t).Error; err != nil {
+		return "", err
+	}
+	if t.ID == 0 || time.Now().After(t.ExpiresAt) {
+		return "", push.ErrNoToken
+	}
+	return decrypt(t.AccessToken)
+}
+
+// accountToken returns the AniList access token of a user linked to account, or push.ErrNoToken
+func accountToken(username, account string) (string, error) {
+	if tokenKey == nil {
+		return "", push.ErrNoToken
+	}
+
+	var t Token
+	if err := db.DB.Where("username = ?", username).Limit(1).Find(&t).Error; err != nil {
+		return "", err
+	}
+	if t.ID == 0 || time.Now().After(t.ExpiresAt) {
+		return "", push.ErrNoToken
+	}
+	token, err := decrypt(t.AccessToken)
+	if err != nil {
+		return "", err
+	}
+
+	if t.Account == "" {
+		if t.Account, err = viewerName(token); err != nil {
+			return "", err
+		}
+		if err := db.DB.Model(&t).Update("account", t.Account).Error; err != nil {
+			return "", err
+		}
+	}
+	if !strings.EqualFold(t.Account, account) {
+		return "", push.ErrNoToken
+	}
+	return token, nil
+}
+
+// viewerQuery asks AniList for the user an access token belongs to
+const viewerQuery = `query { Viewer { name } }`
+
+// viewerName returns the name of the AniList user an access token belongs to
+func viewerName(token string) (string, error) {
+	body, err := json.Marshal(map[string]string{"query": viewerQuery})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := GraphQLEndpoint
+	if endpoint == "" {
+		endpoint = push.DefaultEndpoint
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Data struct {
+			Viewer struct {
+				Name string `json:"name"`
+			} `json:"Viewer"`
+		} `json:"data"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("viewer query responded with %s", resp.Status)
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+	if res.Data.Viewer.Name == "" {
+		return "", errors.New("viewer query returned no user name")
+	}
+	return res.Data.Viewer.Name, nil
+}
+
+// newNonce returns a random value for the login cookie
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signState returns a login state naming the user and the nonce of the login cookie, valid for stateTTL
+func signState(username, nonce string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(username + "\n" + strconv.FormatInt(time.Now().Add(stateTTL).Unix(), 10) + "\n" + nonce))
+	return payload + "." + stateMAC(payload)
+}
+
+// verifyState returns the user named by a state created by signState for the login cookie's nonce
+func verifyState(state, nonce string) (string, error) {
+	payload, mac, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(stateMAC(payload))) {
+		return "", errors.New("invalid state")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", errors.New("invalid state")
+	}
+	parts := strings.Split(string(data), "\n")
+	if len(parts) != 3 {
+		return "", errors.New("invalid state")
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", errors.New("login expired, please start again")
+	}
+	if nonce == "" || !hmac.Equal([]byte(parts[2]), []byte(nonce)) {
+		return "", errors.New("login was started in another browser, please start again")
+	}
+	return parts[0], nil
+}
+
+// setLoginCookie stores the login nonce for the callback, or clears it when nonce is empty
+func setLoginCookie(c *gin.Context, nonce string) {
+	maxAge := int(stateTTL.Seconds())
+	if nonce == "" {
+		maxAge = -1
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginCookie, nonce, maxAge, "/auth/anilist", "", strings.HasPrefix(OAuth.RedirectURL, "https://"), true)
+}
+
+// stateMAC signs a state payload with a key derived from tokenKey
+func stateMAC(payload string) string {
+	key := sha256.Sum256(append([]byte("anilist oauth state "), tokenKey...))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tokenResponse is the reply of the AniList token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// exchangeCode trades an authorization code for an access token
+func exchangeCode(code string) (*tokenResponse, error) {
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     OAuth.ClientID,
+		"client_secret": OAuth.ClientSecret,
+		"redirect_uri":  OAuth.RedirectURL,
+		"code":          code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, OAuth.TokenURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with %s", resp.Status)
+	}
+
+	var res tokenResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+	return &res, nil
+}
+
+// oauthEnabled writes an error response and returns false when account linking isn't configured
+func oauthEnabled(c *gin.Context) bool {
+	if OAuth.ClientID == "" || tokenKey == nil {
+		c.JSON(503, gin.H{"error": "AniList account linking is not configured"})
+		return false
+	}
+	return true
+}
+
+// LoginResponse holds the AniList page authorizing this server
+type LoginResponse struct {
+	URL string `json:"url"`
+}
+
+// LoginHandler godoc
+// @Summary Link an AniList account
+// @Description Returns the AniList page authorizing this server. After approval AniList redirects back to /auth/anilist/callback,
+// @Description which stores the access token of the user. Linked users can sync private lists and push local changes.
+// @Description The login is bound to a cookie set by this response, so call it from the browser with credentials and open the URL in it.
+// @Tags auth
+// @Produce json
+// @Param username query string false "Local user to link, defaults to the caller"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/anilist/login [get]
+// LoginHandler starts the AniList authorization code flow
+func LoginHandler(c *gin.Context) {
+	if !oauthEnabled(c) {
+		return
+	}
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	setLoginCookie(c, nonce)
+
+	q := url.Values{
+		"client_id":     {OAuth.ClientID},
+		"redirect_uri":  {OAuth.RedirectURL},
+		"response_type": {"code"},
+		"state":         {signState(username, nonce)},
+	}
+	c.JSON(200, LoginResponse{URL: OAuth.AuthURL + "?" + q.Encode()})
+}
+
+// CallbackHandler godoc
+// @Summary Finish linking an AniList account
+// @Description Exchanges the authorization code sent by AniList for an access token and stores it encrypted for the user named in the state.
+// @Description The AniList account the token belongs to becomes the user's AniList account for syncs.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State created by the login"
+// @Success 200 {object} Token
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /auth/anilist/callback [get]
+// CallbackHandler completes the AniList authorization code flow
+func CallbackHandler(c *gin.Context) {
+	if !oauthEnabled(c) {
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(400, gin.H{"error": "authorization failed: " + e})
+		return
+	}
+
+	nonce, _ := c.Cookie(loginCookie)
+	username, err := verifyState(c.Query("state"), nonce)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	setLoginCookie(c, "")
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(400, gin.H{"error": "code query parameter is required"})
+		return
+	}
+
+	res, err := exchangeCode(code)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "failed to get AniList token: " + err.Error()})
+		return
+	}
+	account, err := viewerName(res.AccessToken)
+	if err != nil {
+		c.JSON(502, gin.H{"error": "failed to look up the AniList account: " + err.Error()})
+		return
+	}
+	sealed, err := encrypt(res.AccessToken)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	lifetime := time.Duration(res.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	t := Token{Username: username, Account: account, AccessToken: sealed, ExpiresAt: time.Now().Add(lifetime)}
+	err = db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}},
+		DoUpdates: clause.AssignmentColumns([]string{"account", "access_token", "expires_at", "updated_at"}),
+	}).Create(&t).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := SetAccount(username, push.Provider, account); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.DB.Where("username = ?", username).First(&t)
+	c.JSON(200, t)
+}
+
+// UnlinkHandler godoc
+// @Summary Unlink an AniList account
+// @Description Deletes the stored access token of a user. Syncs fall back to public lists and pushes wait until the account is linked again.
+// @Tags auth
+// @Param username query string false "Local user to unlink, defaults to the caller"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /auth/anilist [delete]
+// UnlinkHandler removes a linked AniList account
+func UnlinkHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	res := db.DB.Where("username = ?", username).Delete(&Token{})
+	if res.Error != nil {
+		c.JSON(500, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "no linked AniList account for this user"})
+		return
+	}
+	c.Status(204)
+}
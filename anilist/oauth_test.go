@@ -0,0 +1,163 @@
+package anilist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"everythingtracker/auth"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// linkServer points the OAuth client at a stub AniList accepting the code "good" and returns the API key of a new user alice
+func linkServer(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	openTestDB(t)
+	if err := db.MigrateModels(&Token{}, &auth.User{}, &auth.APIToken{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stub := http.NewServeMux()
+	stub.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["code"] != "good" || req["client_secret"] != "shh" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"alice-token","expires_in":0}`))
+	})
+	stub.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer alice-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":{"Viewer":{"name":"Alice_on_AniList"}}}`))
+	})
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	oauth, endpoint, key := OAuth, GraphQLEndpoint, tokenKey
+	t.Cleanup(func() { OAuth, GraphQLEndpoint, tokenKey = oauth, endpoint, key })
+	OAuth = OAuthConfig{
+		ClientID:     "42",
+		ClientSecret: "shh",
+		RedirectURL:  "http://tracker.test/auth/anilist/callback",
+		AuthURL:      srv.URL + "/oauth/authorize",
+		TokenURL:     srv.URL + "/oauth/token",
+	}
+	GraphQLEndpoint = srv.URL + "/graphql"
+	if err := SetTokenKey(base64.StdEncoding.EncodeToString(make([]byte, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := auth.CreateUser("alice", "password1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, _, err := auth.NewToken(user, "test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterRoutes(r)
+	return r, apiKey
+}
+
+// login starts a login as the API client would and returns the login cookie and the state sent to AniList
+func login(t *testing.T, r *gin.Engine, apiKey string) (*http.Cookie, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/auth/anilist/login", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body)
+	}
+
+	var res LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(res.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := u.Query(); q.Get("client_id") != "42" || q.Get("redirect_uri") != OAuth.RedirectURL || q.Get("state") == "" {
+		t.Errorf("authorize URL = %s", res.URL)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != loginCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v, want the login cookie", cookies)
+	}
+	return cookies[0], u.Query().Get("state")
+}
+
+// callback sends AniList's redirect back with the given cookie
+func callback(r *gin.Engine, code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/anilist/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLinkAccount(t *testing.T) {
+	r, apiKey := linkServer(t)
+	cookie, state := login(t, r, apiKey)
+
+	w := callback(r, "good", state, cookie)
+	if w.Code != 200 {
+		t.Fatalf("callback returned %d: %s", w.Code, w.Body)
+	}
+
+	token, err := accountToken("alice", "alice_on_anilist")
+	if err != nil || token != "alice-token" {
+		t.Errorf("stored token = %q, %v", token, err)
+	}
+	if name, err := AccountName("alice", "anilist"); err != nil || name != "Alice_on_AniList" {
+		t.Errorf("account = %q, %v", name, err)
+	}
+}
+
+func TestLinkAccountRejected(t *testing.T) {
+	r, apiKey := linkServer(t)
+	cookie, state := login(t, r, apiKey)
+	other, _ := login(t, r, apiKey)
+
+	tests := []struct {
+		name   string
+		code   string
+		state  string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"without the login cookie", "good", state, nil, 400},
+		{"with the cookie of another login", "good", state, other, 400},
+		{"with a forged state", "good", state + "x", cookie, 400},
+		{"with a code AniList rejects", "bad", state, cookie, 502},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := callback(r, tt.code, tt.state, tt.cookie); w.Code != tt.want {
+				t.Errorf("callback returned %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	var count int64
+	db.DB.Model(&Token{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d tokens stored, want none", count)
+	}
+}
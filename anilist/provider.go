@@ -0,0 +1,91 @@
+package anilist
+
+import (
+	"everythingtracker/base"
+	"everythingtracker/provider"
+)
+
+// Provider serves anime and manga metadata and user lists from AniList
+type Provider struct{}
+
+// Name implements provider.Provider
+func (Provider) Name() string {
+	return "anilist"
+}
+
+// Lookup implements provider.Provider
+func (p Provider) Lookup(mediaType string, externalID int) (*base.BaseMedia, error) {
+	var media base.BaseMedia
+	switch mediaType {
+	case MediaTypeAnime:
+		item, err := GetAnimeByExternalID(externalID)
+		if err != nil {
+			return nil, err
+		}
+		media = item.BaseMedia
+	case MediaTypeManga:
+		item, err := GetMangaByExternalID(externalID)
+		if err != nil {
+			return nil, err
+		}
+		media = item.BaseMedia
+	default:
+		return nil, provider.ErrUnsupportedMediaType
+	}
+
+	media.Provider = p.Name()
+	return &media, nil
+}
+
+// Search implements provider.Provider
+func (p Provider) Search(mediaType string, query string, count int) ([]base.BaseMedia, error) {
+	switch mediaType {
+	case MediaTypeAnime:
+		items, err := SearchAnilistAnime(query, count)
+		if err != nil {
+			return nil, err
+		}
+		return p.collect(len(items), func(i int) base.BaseMedia { return items[i].BaseMedia }), nil
+	case MediaTypeManga:
+		items, err := SearchAnilistManga(query, count)
+		if err != nil {
+			return nil, err
+		}
+		return p.collect(len(items), func(i int) base.BaseMedia { return items[i].BaseMedia }), nil
+	}
+	return nil, provider.ErrUnsupportedMediaType
+}
+
+// HasUserLists implements provider.Provider
+func (Provider) HasUserLists(mediaType string) bool {
+	return mediaType == MediaTypeAnime || mediaType == MediaTypeManga
+}
+
+// FetchUserList implements provider.Provider, account is the AniList user name
+func (p Provider) FetchUserList(mediaType string, username, account string) ([]base.BaseMedia, error) {
+	switch mediaType {
+	case MediaTypeAnime:
+		items, err := FetchAniListAnime(username, account)
+		if err != nil {
+			return nil, err
+		}
+		return p.collect(len(items), func(i int) base.BaseMedia { return items[i].BaseMedia }), nil
+	case MediaTypeManga:
+		items, err := FetchAniListManga(username, account)
+		if err != nil {
+			return nil, err
+		}
+		return p.collect(len(items), func(i int) base.BaseMedia { return items[i].BaseMedia }), nil
+	}
+	return nil, provider.ErrUnsupportedMediaType
+}
+
+// collect converts n items to BaseMedia tagged with the provider name
+func (p Provider) collect(n int, at func(int) base.BaseMedia) []base.BaseMedia {
+	res := make([]base.BaseMedia, n)
+	for i := range res {
+		res[i] = at(i)
+		res[i].Provider = p.Name()
+	}
+	return res
+}
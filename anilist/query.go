@@ -0,0 +1,114 @@
+package anilist
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseMediaQuery reads the list owner, filters, sorting and pagination from the query string
+// It writes a 400 or 403 response and returns false when a parameter is invalid
+func parseMediaQuery(c *gin.Context) (db.MediaQuery, bool) {
+	q, ok := parseListQuery(c)
+	if !ok {
+		return q, false
+	}
+	q.Username, ok = auth.Username(c, c.Query("username"))
+	return q, ok
+}
+
+// parseListQuery reads the filters, sorting and pagination from the query string, leaving the owner unset
+// It writes a 400 response and returns false when a parameter is invalid
+func parseListQuery(c *gin.Context) (db.MediaQuery, bool) {
+	q := db.MediaQuery{Provider: c.Query("provider")}
+
+	for _, raw := range c.QueryArray("status") {
+		for _, s := range strings.Split(raw, ",") {
+			status := base.MediaStatus(strings.TrimSpace(s))
+			if !status.Valid() {
+				c.JSON(400, gin.H{"error": "unknown status: " + s})
+				return q, false
+			}
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+
+	q.Title = c.Query("title")
+
+	q.Tags = c.QueryArray("tag")
+
+	bounds := map[string]**float64{
+		"progress_min": &q.ProgressMin,
+		"progress_max": &q.ProgressMax,
+		"score_min":    &q.ScoreMin,
+		"score_max":    &q.ScoreMax,
+	}
+	for name, dest := range bounds {
+		if raw := c.Query(name); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				c.JSON(400, gin.H{"error": name + " must be a number"})
+				return q, false
+			}
+			*dest = &v
+		}
+	}
+
+	if raw := c.Query("updated_since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "updated_since must be an RFC3339 timestamp"})
+			return q, false
+		}
+		q.UpdatedSince = &t
+	}
+
+	q.Sort = c.Query("sort")
+	if _, ok := db.SortColumns[q.Sort]; q.Sort != "" && !ok {
+		c.JSON(400, gin.H{"error": "sort must be one of title, updated_at, progress, score"})
+		return q, false
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		c.JSON(400, gin.H{"error": "order must be asc or desc"})
+		return q, false
+	}
+
+	var err error
+	if q.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || q.Limit < 0 {
+		c.JSON(400, gin.H{"error": "limit must be a non-negative integer"})
+		return q, false
+	}
+	if q.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || q.Offset < 0 {
+		c.JSON(400, gin.H{"error": "offset must be a non-negative integer"})
+		return q, false
+	}
+
+	return q, true
+}
+
+// setPageHeaders reports the total number of matching items in X-Total-Count
+// and, when more items remain, a Link header pointing at the next page
+func setPageHeaders(c *gin.Context, q db.MediaQuery, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	if q.Limit == 0 || int64(q.Offset+q.Limit) >= total {
+		return
+	}
+
+	next := *c.Request.URL
+	values := next.Query()
+	values.Set("offset", strconv.Itoa(q.Offset+q.Limit))
+	next.RawQuery = values.Encode()
+	c.Header("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
@@ -1,21 +1,66 @@
 package anilist
 
-import "github.com/gin-gonic/gin"
+import (
+	"everythingtracker/auth"
+
+	"github.com/gin-gonic/gin"
+)
 
 // RegisterRoutes registers all anilist-related routes to the Gin router
+// Everything but media types, search, shared lists and the OAuth callback requires an API key with the scope of its group
 func RegisterRoutes(r *gin.Engine) {
-	// Items endpoints
-	r.GET("/items/anime", GetAnimeHandler)
-	r.POST("/items/anime", PostAnimeHandler)
+	api := r.Group("", auth.Middleware())
+	read := api.Group("", auth.RequireScope(auth.ScopeItemsRead))
+	write := api.Group("", auth.RequireScope(auth.ScopeItemsWrite))
+	sync := api.Group("", auth.RequireScope(auth.ScopeSyncRun))
+
+	// Items endpoints, served for every registered media type
+	r.GET("/types", MediaTypesHandler)
+	read.GET("/items/:type", GetItemsHandler)
+	write.POST("/items/:type", PostItemHandler)
+	read.GET("/items/:type/:external_id", GetItemHandler)
+	write.PATCH("/items/:type/:external_id", PatchItemHandler)
+	write.DELETE("/items/:type/:external_id", DeleteItemHandler)
+	write.POST("/items/:type/:external_id/progress", ProgressItemHandler)
+	write.POST("/items/:type/:external_id/link", LinkItemHandler)
+	read.GET("/items/:type/:external_id/history", ItemHistoryHandler)
+
+	read.GET("/activity", ActivityHandler)
+
+	// Trash endpoints
+	read.GET("/trash/:type", GetTrashHandler)
+	write.POST("/trash/:type/:external_id/restore", RestoreHandler)
+	write.DELETE("/trash/:type/:external_id", PurgeHandler)
+
+	// purging affects every user
+	api.POST("/trash/purge", auth.AdminOnly(), PurgeTrashHandler)
+
+	// Sync conflict endpoints
+	sync.GET("/sync/policy", GetSyncPolicyHandler)
+	sync.PUT("/sync/policy", PutSyncPolicyHandler)
+	read.GET("/conflicts", GetConflictsHandler)
+	write.POST("/conflicts/:id/resolve", ResolveConflictHandler)
+
+	// Provider accounts whose lists are synced
+	sync.GET("/accounts", GetAccountsHandler)
+	sync.PUT("/accounts/:provider", PutAccountHandler)
+	sync.DELETE("/accounts/:provider", DeleteAccountHandler)
+
+	// AniList account linking, the callback identifies the user by its state
+	sync.GET("/auth/anilist/login", LoginHandler)
+	r.GET("/auth/anilist/callback", CallbackHandler)
+	sync.DELETE("/auth/anilist", UnlinkHandler)
 
-	r.GET("/items/manga", GetMangaHandler)
-	r.POST("/items/manga", PostMangaHandler)
+	// Share endpoints, shared lists are public
+	write.POST("/shares", CreateShareHandler)
+	read.GET("/shares", GetSharesHandler)
+	write.DELETE("/shares/:id", RevokeShareHandler)
+	r.GET("/share/:token/:type", SharedListHandler)
 
-	// Sync endpoints
-	r.POST("/sync/anilist/anime", SyncAnimeHandler)
-	r.POST("/sync/anilist/manga", SyncMangaHandler)
+	// Import endpoints
+	api.POST("/import/mal", auth.RequireScope(auth.ScopeImport), ImportMALHandler)
+	api.POST("/import/goodreads", auth.RequireScope(auth.ScopeImport), ImportGoodreadsHandler)
 
 	// Search endpoints
-	r.GET("/search/anilist/anime", SearchAnimeHandler)
-	r.GET("/search/anilist/manga", SearchMangaHandler)
+	r.GET("/search/:provider/:type", SearchHandler)
 }
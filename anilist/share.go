@@ -0,0 +1,268 @@
+package anilist
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ShareLink grants anyone holding its token read-only access to a user's lists
+// Unlike API keys the token is stored as is, so the owner can copy the link again later
+type ShareLink struct {
+	ID         uint               `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Username   string             `gorm:"index" json:"username"`
+	Token      string             `gorm:"uniqueIndex" json:"token"`
+	MediaTypes []string           `gorm:"serializer:json" json:"media_types"` // every media type when empty
+	Statuses   []base.MediaStatus `gorm:"serializer:json" json:"statuses"`    // every status when empty
+	ExpiresAt  *time.Time         `json:"expires_at"`                         // never expires when nil
+	RevokedAt  *time.Time         `json:"revoked_at"`
+}
+
+// TableName sets the table name for share links
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+// ShareRequest creates a share link
+type ShareRequest struct {
+	Username   string             `json:"username"`
+	MediaTypes []string           `json:"media_types"`
+	Statuses   []base.MediaStatus `json:"statuses"`
+	ExpiresAt  *time.Time         `json:"expires_at"`
+}
+
+// allows reports whether the link shares the list of a media type
+func (s *ShareLink) allows(mediaType string) bool {
+	return len(s.MediaTypes) == 0 || slices.Contains(s.MediaTypes, mediaType)
+}
+
+// restrict limits the statuses of a list query to the shared ones
+// It returns false when none of the requested statuses are shared
+func (s *ShareLink) restrict(q *db.MediaQuery) bool {
+	if len(s.Statuses) == 0 {
+		return true
+	}
+	if len(q.Statuses) == 0 {
+		q.Statuses = s.Statuses
+		return true
+	}
+	q.Statuses = slices.DeleteFunc(q.Statuses, func(status base.MediaStatus) bool {
+		return !slices.Contains(s.Statuses, status)
+	})
+	return len(q.Statuses) > 0
+}
+
+// findShare resolves the share link of a request for a media type
+// It writes a 404 response and returns false for unknown, revoked or expired links
+func findShare(c *gin.Context, mediaType string) (*ShareLink, bool) {
+	var s ShareLink
+	if err := db.DB.Where("token = ?", c.Param("token")).Limit(1).Find(&s).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if s.ID == 0 || s.RevokedAt != nil || s.ExpiresAt != nil && time.Now().After(*s.ExpiresAt) || !s.allows(mediaType) {
+		c.JSON(404, gin.H{"error": "share link not found"})
+		return nil, false
+	}
+	return &s, true
+}
+
+// CreateShareHandler godoc
+// @Summary Create a share link
+// @Description Creates a token granting anyone read-only access to the user's lists through /share/{token}/{type},
+// @Description optionally limited to some media types and statuses and given an expiry. Notes are never shared.
+// @Tags share
+// @Accept json
+// @Produce json
+// @Param share body ShareRequest true "Share settings"
+// @Success 201 {object} ShareLink
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /shares [post]
+// CreateShareHandler handles creation of share links
+func CreateShareHandler(c *gin.Context) {
+	var req ShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if req.Username, ok = auth.Username(c, req.Username); !ok {
+		return
+	}
+	for _, t := range req.MediaTypes {
+		if _, ok := base.LookupMediaType(t); !ok {
+			c.JSON(400, gin.H{"error": "unknown media type: " + t})
+			return
+		}
+	}
+	for _, s := range req.Statuses {
+		if !s.Valid() {
+			c.JSON(400, gin.H{"error": "unknown status: " + string(s)})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	s := ShareLink{
+		Username:   req.Username,
+		Token:      base64.RawURLEncoding.EncodeToString(b),
+		MediaTypes: req.MediaTypes,
+		Statuses:   req.Statuses,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := db.DB.Create(&s).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, s)
+}
+
+// GetSharesHandler godoc
+// @Summary List share links of a user
+// @Description Returns the share links of the user, including revoked and expired ones, newest first.
+// @Tags share
+// @Produce json
+// @Param username query string false "Owner of the links, defaults to the caller"
+// @Success 200 {array} ShareLink
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /shares [get]
+// GetSharesHandler handles GET requests for share links
+func GetSharesHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	shares := []ShareLink{}
+	if err := db.DB.Where("username = ?", username).Order("id DESC").Find(&shares).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, shares)
+}
+
+// RevokeShareHandler godoc
+// @Summary Revoke a share link
+// @Description Revokes a share link, requests with its token get 404 from then on.
+// @Tags share
+// @Produce json
+// @Param id path int true "Share link ID"
+// @Success 200 {object} ShareLink
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /shares/{id} [delete]
+// RevokeShareHandler handles revocation of share links
+func RevokeShareHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	var s ShareLink
+	err = db.DB.First(&s, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "share link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := auth.Username(c, s.Username); !ok {
+		return
+	}
+	if s.RevokedAt != nil {
+		c.JSON(409, gin.H{"error": "share link is already revoked"})
+		return
+	}
+
+	if err := db.DB.Model(&s).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, s)
+}
+
+// SharedListHandler godoc
+// @Summary Get a shared list
+// @Description Returns the items of the media type shared by a link, with the filters, sorting and pagination of GET /items/{type}.
+// @Description Only the shared statuses are returned and notes are left empty. No API key is needed.
+// @Tags share
+// @Produce json
+// @Param token path string true "Share token"
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param provider query string false "Only return items from this metadata provider"
+// @Param status query []string false "Only return items with these statuses" collectionFormat(multi)
+// @Param title query string false "Only return items whose title contains this text"
+// @Param tag query []string false "Only return items carrying all of these tags" collectionFormat(multi)
+// @Param sort query string false "Sort key" Enums(title, updated_at, progress, score)
+// @Param order query string false "Sort order" Enums(asc, desc) default(asc)
+// @Param limit query int false "Page size, 0 returns all items" default(0)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Success 200 {array} base.BaseMedia
+// @Header 200 {integer} X-Total-Count "Total number of matching items"
+// @Header 200 {string} Link "Link to the next page"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /share/{token}/{type} [get]
+// SharedListHandler handles GET requests for shared lists
+func SharedListHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	s, ok := findShare(c, t.Name)
+	if !ok {
+		return
+	}
+	q, ok := parseListQuery(c)
+	if !ok {
+		return
+	}
+	q.Username = s.Username
+	if !s.restrict(&q) {
+		setPageHeaders(c, q, 0)
+		c.JSON(200, []base.BaseMedia{})
+		return
+	}
+
+	items, total, err := db.ListMedia(t.Table, q)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range items {
+		items[i].Notes = ""
+	}
+
+	setPageHeaders(c, q, total)
+	c.JSON(200, items)
+}
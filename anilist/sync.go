@@ -0,0 +1,358 @@
+package anilist
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/push"
+
+	"gorm.io/gorm"
+)
+
+// syncEvent describes the progress change made by a provider sync
+func syncEvent(mediaType string, old, new base.BaseMedia, remoteUpdatedAt time.Time) *base.ProgressEvent {
+	event := base.NewProgressEvent(mediaType, old, new, base.SourceSync)
+	if event != nil && !remoteUpdatedAt.IsZero() {
+		event.CreatedAt = remoteUpdatedAt
+	}
+	return event
+}
+
+// SyncStats counts what a sync did with the fetched entries
+type SyncStats struct {
+	Processed int `json:"processed"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Skipped   int `json:"skipped"`
+	Deleted   int `json:"deleted"`
+	Conflicts int `json:"conflicts"`
+	// Removed lists the external IDs of synced entries no longer on the provider's list
+	Removed []int `json:"removed"`
+}
+
+// SyncOptions control how a fetched user list is written
+type SyncOptions struct {
+	// Prune soft-deletes synced entries missing from the provider's list instead of only reporting them
+	Prune bool `json:"prune"`
+	// Policy decides which copy wins when an entry differs locally and at the provider
+	Policy ConflictPolicy `json:"policy"`
+}
+
+// FieldChange is a single field of an entry that a sync changes
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// EntryDiff describes what a sync does with one entry
+type EntryDiff struct {
+	ExternalID int           `json:"external_id"`
+	Title      string        `json:"title"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+// SyncDiff lists what a sync would do without writing anything
+type SyncDiff struct {
+	Prune     bool           `json:"prune"`
+	Policy    ConflictPolicy `json:"policy"`
+	Created   []EntryDiff    `json:"created"`
+	Updated   []EntryDiff    `json:"updated"`
+	Skipped   []EntryDiff    `json:"skipped"`   // changed at the provider, kept by the policy
+	Conflicts []EntryDiff    `json:"conflicts"` // local value as Old, the provider's as New
+	Removed   []EntryDiff    `json:"removed"`
+}
+
+// syncField reads and copies one of the columns written by a sync
+type syncField struct {
+	name string
+	get  func(m *base.BaseMedia) any
+	set  func(dst, src *base.BaseMedia)
+}
+
+// equal reports whether the field has the same value in a and b
+func (f syncField) equal(a, b *base.BaseMedia) bool {
+	x, y := f.get(a), f.get(b)
+	if t, ok := x.(*time.Time); ok {
+		return sameTime(t, y.(*time.Time))
+	}
+	return x == y
+}
+
+// syncFields are the fields compared and merged by a sync, named after their columns
+var syncFields = []syncField{
+	{"title", func(m *base.BaseMedia) any { return m.Title }, func(d, s *base.BaseMedia) { d.Title = s.Title }},
+	{"status", func(m *base.BaseMedia) any { return m.Status }, func(d, s *base.BaseMedia) { d.Status = s.Status }},
+	{"progress_current", func(m *base.BaseMedia) any { return m.ProgressCurrent }, func(d, s *base.BaseMedia) { d.ProgressCurrent = s.ProgressCurrent }},
+	{"progress_total", func(m *base.BaseMedia) any { return m.ProgressTotal }, func(d, s *base.BaseMedia) { d.ProgressTotal = s.ProgressTotal }},
+	{"progress_unit", func(m *base.BaseMedia) any { return m.ProgressUnit }, func(d, s *base.BaseMedia) { d.ProgressUnit = s.ProgressUnit }},
+	{"score", func(m *base.BaseMedia) any { return m.Score }, func(d, s *base.BaseMedia) { d.Score = s.Score }},
+	{"repeat_count", func(m *base.BaseMedia) any { return m.RepeatCount }, func(d, s *base.BaseMedia) { d.RepeatCount = s.RepeatCount }},
+	{"notes", func(m *base.BaseMedia) any { return m.Notes }, func(d, s *base.BaseMedia) { d.Notes = s.Notes }},
+	{"started_at", func(m *base.BaseMedia) any { return m.StartedAt }, func(d, s *base.BaseMedia) { d.StartedAt = s.StartedAt }},
+	{"completed_at", func(m *base.BaseMedia) any { return m.CompletedAt }, func(d, s *base.BaseMedia) { d.CompletedAt = s.CompletedAt }},
+}
+
+// findSyncField looks up a synced field by column name
+func findSyncField(name string) (syncField, bool) {
+	for _, f := range syncFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return syncField{}, false
+}
+
+// fieldChanges compares the synced fields of two copies of an entry
+func fieldChanges(old, new base.BaseMedia) []FieldChange {
+	var changes []FieldChange
+	for _, f := range syncFields {
+		if !f.equal(&old, &new) {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.get(&old), New: f.get(&new)})
+		}
+	}
+	return changes
+}
+
+// sameTime reports whether two optional times are both unset or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// mergeEntry decides which copy of an existing entry a sync keeps under policy
+func mergeEntry(policy ConflictPolicy, local, remote base.BaseMedia) (base.BaseMedia, []FieldChange) {
+	merged := local
+	takeRemote := func() {
+		for _, f := range syncFields {
+			f.set(&merged, &remote)
+		}
+	}
+
+	var ancestor *base.BaseMedia
+	if local.SyncBase != nil {
+		m := local.SyncBase.Media()
+		ancestor = &m
+	}
+
+	var conflicts []FieldChange
+	switch policy {
+	case PolicyRemoteWins:
+		takeRemote()
+	case PolicyLocalWins:
+		// only fields left untouched locally since the last sync follow the provider
+		for _, f := range syncFields {
+			if ancestor != nil && f.equal(&local, ancestor) {
+				f.set(&merged, &remote)
+			}
+		}
+	case PolicyMaxProgressWins:
+		if remote.ProgressCurrent > local.ProgressCurrent ||
+			remote.ProgressCurrent == local.ProgressCurrent && remote.UpdatedAt.After(local.UpdatedAt) {
+			takeRemote()
+		}
+	case PolicyFieldMerge:
+		for _, f := range syncFields {
+			switch {
+			case f.equal(&local, &remote):
+			case ancestor != nil && f.equal(&local, ancestor):
+				f.set(&merged, &remote)
+			case ancestor != nil && f.equal(&remote, ancestor):
+				// changed locally only, keep it
+			default:
+				conflicts = append(conflicts, FieldChange{Field: f.name, Old: f.get(&local), New: f.get(&remote)})
+			}
+		}
+	default:
+		if remote.UpdatedAt.After(local.UpdatedAt) {
+			takeRemote()
+		}
+	}
+
+	if len(fieldChanges(local, merged)) > 0 && remote.UpdatedAt.After(local.UpdatedAt) {
+		merged.UpdatedAt = remote.UpdatedAt
+	}
+	return merged, conflicts
+}
+
+// snapshotStale reports whether the stored snapshot of an entry no longer matches the provider's copy
+func snapshotStale(local, remote base.BaseMedia) bool {
+	if local.SyncBase == nil {
+		return true
+	}
+	return !local.SyncBase.UpdatedAt.Equal(remote.UpdatedAt) || len(fieldChanges(local.SyncBase.Media(), remote)) > 0
+}
+
+// syncPlan holds the writes a sync makes together with their diff
+type syncPlan struct {
+	diff      SyncDiff
+	changed   []base.BaseMedia
+	events    []*base.ProgressEvent
+	conflicts []Conflict
+	removed   []int
+	processed int
+}
+
+// planUserList compares a user list fetched from a provider with the local rows without writing anything
+func planUserList(tx *gorm.DB, providerName, mediaType, username string, data []base.BaseMedia, opts SyncOptions) (*syncPlan, error) {
+	t, ok := base.LookupMediaType(mediaType)
+	if !ok {
+		return nil, errors.New("unknown media type: " + mediaType)
+	}
+	existing, err := db.LoadUserMedia(tx, t.Table, username, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &syncPlan{diff: SyncDiff{
+		Prune:     opts.Prune,
+		Policy:    opts.Policy,
+		Created:   []EntryDiff{},
+		Updated:   []EntryDiff{},
+		Skipped:   []EntryDiff{},
+		Conflicts: []EntryDiff{},
+		Removed:   []EntryDiff{},
+	}}
+	seen := map[int]bool{}
+
+	for i := range data {
+		remote := data[i]
+		// an entry can appear in several lists of the same user
+		if seen[remote.ExternalID] {
+			continue
+		}
+		seen[remote.ExternalID] = true
+		plan.processed++
+
+		remote.Username = username
+		remote.Provider = providerName
+		remote.Origin = base.SourceSync
+
+		entry := EntryDiff{ExternalID: remote.ExternalID, Title: remote.Title}
+		old, ok := existing[remote.ExternalID]
+		if !ok {
+			remote.SyncBase = base.NewSyncSnapshot(remote)
+			plan.diff.Created = append(plan.diff.Created, entry)
+			plan.changed = append(plan.changed, remote)
+			if event := syncEvent(mediaType, old, remote, remote.UpdatedAt); event != nil {
+				plan.events = append(plan.events, event)
+			}
+			continue
+		}
+
+		merged, conflicts := mergeEntry(opts.Policy, old, remote)
+		merged.SyncBase = base.NewSyncSnapshot(remote)
+		if len(conflicts) > 0 {
+			plan.diff.Conflicts = append(plan.diff.Conflicts, EntryDiff{ExternalID: entry.ExternalID, Title: entry.Title, Changes: conflicts})
+			for _, change := range conflicts {
+				plan.conflicts = append(plan.conflicts, Conflict{
+					Username:   username,
+					Provider:   providerName,
+					MediaType:  mediaType,
+					ExternalID: remote.ExternalID,
+					Title:      old.Title,
+					Field:      change.Field,
+					Local:      change.Old,
+					Remote:     change.New,
+				})
+			}
+		}
+
+		if entry.Changes = fieldChanges(old, merged); len(entry.Changes) > 0 {
+			if len(conflicts) == 0 {
+				plan.diff.Updated = append(plan.diff.Updated, entry)
+			}
+			if event := syncEvent(mediaType, old, merged, remote.UpdatedAt); event != nil {
+				plan.events = append(plan.events, event)
+			}
+		} else {
+			// the provider's copy differs but the policy kept the local values
+			if entry.Changes = fieldChanges(old, remote); len(entry.Changes) > 0 && len(conflicts) == 0 {
+				plan.diff.Skipped = append(plan.diff.Skipped, entry)
+			}
+			if !snapshotStale(old, remote) {
+				continue
+			}
+			// nothing changes locally, only the snapshot of the provider's copy is refreshed
+		}
+		plan.changed = append(plan.changed, merged)
+	}
+
+	for id, old := range existing {
+		if !seen[id] && old.Origin == base.SourceSync {
+			plan.removed = append(plan.removed, id)
+		}
+	}
+	slices.Sort(plan.removed)
+	for _, id := range plan.removed {
+		plan.diff.Removed = append(plan.diff.Removed, EntryDiff{ExternalID: id, Title: existing[id].Title})
+	}
+
+	return plan, nil
+}
+
+// DiffUserList reports what ApplyUserList would do with a fetched user list without touching the database
+func DiffUserList(providerName, mediaType, username string, data []base.BaseMedia, opts SyncOptions) (SyncDiff, error) {
+	plan, err := planUserList(db.DB, providerName, mediaType, username, data, opts)
+	if err != nil {
+		return SyncDiff{}, err
+	}
+	return plan.diff, nil
+}
+
+// ApplyUserList writes a user list fetched from a provider into the local database in one transaction
+func ApplyUserList(providerName, mediaType, username string, data []base.BaseMedia, opts SyncOptions) (SyncStats, error) {
+	var stats SyncStats
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		plan, err := planUserList(tx, providerName, mediaType, username, data, opts)
+		if err != nil {
+			return err
+		}
+		stats = SyncStats{
+			Processed: plan.processed,
+			Created:   len(plan.diff.Created),
+			Updated:   len(plan.diff.Updated),
+			Skipped:   len(plan.diff.Skipped),
+			Conflicts: len(plan.conflicts),
+			Removed:   plan.removed,
+		}
+
+		t, _ := base.LookupMediaType(mediaType)
+		if len(plan.changed) > 0 {
+			if err := db.UpsertMediaBatch(tx, t.Table, plan.changed, syncColumns); err != nil {
+				return err
+			}
+			if err := push.Reconcile(tx, username, mediaType, plan.changed); err != nil {
+				return err
+			}
+		}
+		if len(plan.events) > 0 {
+			if err := tx.CreateInBatches(plan.events, db.BatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(plan.conflicts) > 0 {
+			if err := tx.Clauses(openConflict).CreateInBatches(plan.conflicts, db.BatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if opts.Prune && len(plan.removed) > 0 {
+			deleted, err := db.DeleteUserMedia(tx, t.Table, username, providerName, plan.removed)
+			if err != nil {
+				return err
+			}
+			stats.Deleted = int(deleted)
+		}
+		return nil
+	})
+	if err != nil {
+		return SyncStats{}, err
+	}
+	return stats, nil
+}
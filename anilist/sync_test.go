@@ -0,0 +1,133 @@
+package anilist
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/push"
+
+	"gorm.io/gorm"
+)
+
+// benchEntries is the size of the user list synced by BenchmarkApplyUserList
+const benchEntries = 2000
+
+// openTestDB points db.DB at a fresh database in a temporary directory with the tables written by syncs
+func openTestDB(tb testing.TB) {
+	tb.Helper()
+	db.InitDatabase(filepath.Join(tb.TempDir(), "test.sqlite"))
+	RegisterMediaTypes()
+	if err := db.MigrateMediaTypes(AnimeType, MangaType); err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.MigrateModels(&base.ProgressEvent{}); err != nil {
+		tb.Fatal(err)
+	}
+	if err := MigrateSync(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := push.Migrate(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// userList returns a fetched list of n anime
+func userList(n int) []base.BaseMedia {
+	data := make([]base.BaseMedia, n)
+	for i := range data {
+		data[i] = base.BaseMedia{
+			ExternalID:      i + 1,
+			Title:           "Anime " + strconv.Itoa(i+1),
+			Status:          base.StatusWatching,
+			ProgressCurrent: float64(i % 12),
+			ProgressTotal:   12,
+			ProgressUnit:    "ep",
+		}
+	}
+	return data
+}
+
+// applyPerRow writes the same plan as ApplyUserList with one statement per row, as syncs did before batching
+func applyPerRow(providerName, mediaType, username string, data []base.BaseMedia, opts SyncOptions) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		plan, err := planUserList(tx, providerName, mediaType, username, data, opts)
+		if err != nil {
+			return err
+		}
+		t, _ := base.LookupMediaType(mediaType)
+		for i := range plan.changed {
+			if err := db.UpsertMediaBatch(tx, t.Table, plan.changed[i:i+1], syncColumns); err != nil {
+				return err
+			}
+		}
+		for _, event := range plan.events {
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BenchmarkApplyUserList compares a first sync of a few thousand entries written row by row and in batches
+func BenchmarkApplyUserList(b *testing.B) {
+	openTestDB(b)
+	data := userList(benchEntries)
+	opts := SyncOptions{Prune: true, Policy: PolicyRemoteWins}
+
+	b.Run("per-row", func(b *testing.B) {
+		for i := range b.N {
+			if err := applyPerRow("anilist", MediaTypeAnime, "row"+strconv.Itoa(i), data, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		for i := range b.N {
+			if _, err := ApplyUserList("anilist", MediaTypeAnime, "batch"+strconv.Itoa(i), data, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestDiffUserListConflicts checks that empty categories are lists, entries with conflicts are only listed as conflicts
+// and only entries whose differences were not applied are skipped
+func TestDiffUserListConflicts(t *testing.T) {
+	openTestDB(t)
+	data := userList(3)
+	if _, err := ApplyUserList("anilist", MediaTypeAnime, "alice", data, SyncOptions{Policy: PolicyFieldMerge}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first entry changes on both sides, the second one locally and the third one nowhere
+	for id, progress := range map[int]int{1: 5, 2: 9} {
+		err := db.DB.Table(AnimeType.Table).Where("external_id = ?", id).Update("progress_current", progress).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data[0].ProgressCurrent = 7
+
+	diff, err := DiffUserList("anilist", MediaTypeAnime, "alice", data, SyncOptions{Policy: PolicyFieldMerge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Created == nil || diff.Updated == nil || diff.Removed == nil {
+		t.Errorf("empty categories should be empty lists: %+v", diff)
+	}
+	if len(diff.Conflicts) != 1 || diff.Conflicts[0].ExternalID != 1 {
+		t.Errorf("conflicts = %+v, want entry 1", diff.Conflicts)
+	}
+	for _, entry := range append(diff.Updated, diff.Skipped...) {
+		if entry.ExternalID == 1 {
+			t.Errorf("entry with conflicts is also listed as %+v", entry)
+		}
+	}
+	if len(diff.Skipped) != 1 || diff.Skipped[0].ExternalID != 2 || len(diff.Skipped[0].Changes) == 0 {
+		t.Errorf("skipped = %+v, want entry 2 with its changes", diff.Skipped)
+	}
+}
@@ -0,0 +1,163 @@
+package anilist
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PurgeResponse counts the purged items per media type
+type PurgeResponse map[string]int64
+
+// GetTrashHandler godoc
+// @Summary List trashed items of a media type for a user
+// @Description Returns the soft-deleted items of the media type of the specified user, most recently deleted first.
+// @Tags trash
+// @Produce json
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param username query string false "Username to filter items, defaults to the caller"
+// @Success 200 {array} base.BaseMedia
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /trash/{type} [get]
+// GetTrashHandler handles GET requests for trashed items
+func GetTrashHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	items, err := db.FindDeleted(t.Table, username)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, items)
+}
+
+// RestoreHandler godoc
+// @Summary Restore a trashed item
+// @Description Restores the most recently soft-deleted copy of the item identified by username, provider and external_id.
+// @Tags trash
+// @Produce json
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Success 200 {object} base.BaseMedia
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /trash/{type}/{external_id}/restore [post]
+// RestoreHandler handles restore requests for trashed items
+func RestoreHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
+		return
+	}
+
+	var item base.BaseMedia
+	err := db.RestoreMedia(t.Table, &item, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": t.Name + " item not found in trash"})
+		return
+	}
+	if errors.Is(err, db.ErrActiveExists) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.DB.Table(t.Table).First(&item, item.ID)
+
+	c.JSON(200, item)
+}
+
+// PurgeHandler godoc
+// @Summary Permanently delete a trashed item
+// @Description Permanently removes every soft-deleted copy of the item identified by username, provider and external_id.
+// @Tags trash
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param external_id path int true "External ID of the item"
+// @Param username query string false "Owner of the item, defaults to the caller"
+// @Param provider query string false "Metadata provider of the item, defaults to the first provider of the media type"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /trash/{type}/{external_id} [delete]
+// PurgeHandler handles permanent deletion of trashed items
+func PurgeHandler(c *gin.Context) {
+	t, ok := mediaTypeParam(c)
+	if !ok {
+		return
+	}
+	key, ok := parseItemKey(c, t)
+	if !ok {
+		return
+	}
+
+	count, err := db.PurgeMedia(t.Table, key)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if count == 0 {
+		c.JSON(404, gin.H{"error": t.Name + " item not found in trash"})
+		return
+	}
+
+	c.Status(204)
+}
+
+// PurgeTrashHandler godoc
+// @Summary Purge old trash
+// @Description Permanently removes all items of every media type that were soft-deleted more than older_than_days days ago.
+// @Tags trash
+// @Produce json
+// @Param older_than_days query int true "Minimum age in days of the trashed items to purge"
+// @Success 200 {object} PurgeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Security BearerAuth
+// @Router /trash/purge [post]
+// PurgeTrashHandler handles age-based purge requests for trashed items
+func PurgeTrashHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("older_than_days"))
+	if err != nil || days < 0 {
+		c.JSON(400, gin.H{"error": "older_than_days must be a non-negative integer"})
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	counts, err := db.PurgeDeletedBefore(cutoff, base.MediaTypes()...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, PurgeResponse(counts))
+}
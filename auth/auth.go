@@ -0,0 +1,277 @@
+// Package auth provides local user accounts and API token authentication
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"everythingtracker/base"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// tokenPrefix marks API tokens so they are easy to recognize in configs and logs
+const tokenPrefix = "et_"
+
+// userKey and tokenKey are the context keys of the authenticated user and their API key
+const (
+	userKey  = "auth.user"
+	tokenKey = "auth.token"
+)
+
+// lastUsedInterval limits how often the last use of an API key is written
+const lastUsedInterval = time.Minute
+
+// MinPasswordLength is the shortest accepted password
+const MinPasswordLength = 8
+
+// ErrUsernameTaken is returned when registering a username that already has an account
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrUsernameOwnsLists is returned when registering a username whose lists were stored before it had an account
+var ErrUsernameOwnsLists = errors.New("username already owns lists, ask an admin to create the account")
+
+// RegistrationOpen lets anyone create an account, otherwise only admins can
+var RegistrationOpen bool
+
+// Errors returned by Authenticate for keys that can't be used
+var (
+	ErrInvalidToken = errors.New("invalid API token")
+	ErrExpiredToken = errors.New("API token has expired")
+	ErrRevokedToken = errors.New("API token has been revoked")
+)
+
+// User is a local account, lists and settings belong to the user with the same username
+type User struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Username     string    `gorm:"uniqueIndex" json:"username"`
+	PasswordHash string    `json:"-"`
+	Admin        bool      `json:"admin"` // admins may act on behalf of other users
+}
+
+// TableName sets the table name for users
+func (User) TableName() string {
+	return "users"
+}
+
+// APIToken is a personal API key authenticating its user for the scopes it was given, only a hash of it is stored
+type APIToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the token, to tell tokens apart
+	Hash       string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     []Scope    `gorm:"serializer:json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"` // never expires when nil
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// TableName sets the table name for API tokens
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// HashPassword hashes a password for storage
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether password matches the stored hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// CreateUser creates a regular account in one transaction with the check for a taken username
+// Unless claim is set, usernames owning items are rejected
+func CreateUser(username, password string, claim bool) (*User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{Username: username, PasswordHash: hash}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&User{}).Where("username = ?", username).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrUsernameTaken
+		}
+		if !claim {
+			for _, t := range base.MediaTypes() {
+				var owned int64
+				if err := tx.Table(t.Table).Unscoped().Where("username = ?", username).Count(&owned).Error; err != nil {
+					return err
+				}
+				if owned > 0 {
+					return ErrUsernameOwnsLists
+				}
+			}
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// EnsureAdmin makes username an admin with the given password unless an admin already exists
+// It runs at startup with the configured admin account, registration never creates admins
+// An existing account of that name gets the configured password, so whoever registered it first can't keep it
+func EnsureAdmin(username, password string) error {
+	if username == "" || len(password) < MinPasswordLength {
+		return errors.New("admin username and a password of at least 8 characters are required")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&User{}).Where("admin = ?", true).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins > 0 {
+			return nil
+		}
+
+		var user User
+		if err := tx.Where("username = ?", username).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+		if user.ID == 0 {
+			return tx.Create(&User{Username: username, PasswordHash: hash, Admin: true}).Error
+		}
+		return tx.Model(&user).Updates(map[string]any{"password_hash": hash, "admin": true}).Error
+	})
+}
+
+// hashToken returns the stored form of an API token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken creates an API key for a user and returns it in plain text, it can't be recovered later
+// Keys without scopes get every scope, keys without expiry never expire
+func NewToken(user *User, name string, scopes []Scope, expiresAt *time.Time) (string, *APIToken, error) {
+	if len(scopes) == 0 {
+		scopes = Scopes
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t := &APIToken{UserID: user.ID, Name: name, Prefix: token[:len(tokenPrefix)+6], Hash: hashToken(token), Scopes: scopes, ExpiresAt: expiresAt}
+	if err := db.DB.Create(t).Error; err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// Authenticate resolves an API key and the user owning it and records its use
+func Authenticate(token string) (*User, *APIToken, error) {
+	var t APIToken
+	if err := db.DB.Where("hash = ?", hashToken(token)).Limit(1).Find(&t).Error; err != nil {
+		return nil, nil, err
+	}
+	if t.ID == 0 {
+		return nil, nil, ErrInvalidToken
+	}
+	now := time.Now()
+	if t.RevokedAt != nil {
+		return nil, nil, ErrRevokedToken
+	}
+	if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+		return nil, nil, ErrExpiredToken
+	}
+
+	var user User
+	if err := db.DB.First(&user, t.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > lastUsedInterval {
+		if err := db.DB.Model(&t).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+		t.LastUsedAt = &now
+	}
+	return &user, &t, nil
+}
+
+// Middleware resolves the caller from an "Authorization: Bearer" API token and rejects requests without a valid one
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(401, gin.H{"error": "an API token is required"})
+			return
+		}
+
+		user, t, err := Authenticate(token)
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) || errors.Is(err, ErrRevokedToken) {
+			c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(userKey, user)
+		c.Set(tokenKey, t)
+		c.Next()
+	}
+}
+
+// Current returns the caller resolved by Middleware, or nil outside of it
+func Current(c *gin.Context) *User {
+	v, _ := c.Get(userKey)
+	user, _ := v.(*User)
+	return user
+}
+
+// Username returns the user a request acts for, the requested one when set and the caller otherwise
+// Only admins using a key with the admin scope may act for other users, for anyone else a 403 response is written and false returned
+func Username(c *gin.Context, requested string) (string, bool) {
+	user := Current(c)
+	if requested == "" || requested == user.Username {
+		return user.Username, true
+	}
+	if !isAdmin(c) {
+		c.JSON(403, gin.H{"error": "not allowed to act for " + requested})
+		return "", false
+	}
+	return requested, true
+}
+
+// AdminOnly rejects callers who aren't admins or whose key lacks the admin scope, it must run after Middleware
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdmin(c) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
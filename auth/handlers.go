@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterRequest creates a local account
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// TokenRequest creates an API key for the account identified by username and password
+type TokenRequest struct {
+	Username  string     `json:"username"`
+	Password  string     `json:"password"`
+	Name      string     `json:"name"`       // what the key is used for
+	Scopes    []Scope    `json:"scopes"`     // every scope when empty
+	ExpiresAt *time.Time `json:"expires_at"` // never expires when unset
+}
+
+// TokenResponse holds a newly created API token, it is only shown once
+type TokenResponse struct {
+	Token string    `json:"token"`
+	Info  *APIToken `json:"info"`
+}
+
+// RegisterRoutes registers the account routes to the Gin router
+func RegisterRoutes(r *gin.Engine) {
+	r.POST("/auth/register", RegisterHandler)
+	r.POST("/auth/tokens", CreateTokenHandler)
+
+	api := r.Group("", Middleware())
+	api.GET("/auth/me", MeHandler)
+	api.POST("/auth/users", AdminOnly(), CreateUserHandler)
+
+	// A leaked key limited to other scopes can't be used to find or revoke the account's keys
+	keys := api.Group("", RequireScope(ScopeTokens))
+	keys.GET("/auth/tokens", GetTokensHandler)
+	keys.DELETE("/auth/tokens/:id", RevokeTokenHandler)
+}
+
+// RegisterHandler godoc
+// @Summary Create a local account
+// @Description Creates an account owning the lists stored under its username. Registered accounts are never admins,
+// @Description the admin account is set with the ADMIN_USERNAME and ADMIN_PASSWORD environment variables.
+// @Description Registration is closed unless OPEN_REGISTRATION is set. Usernames already owning lists can only be given out by an admin.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param account body RegisterRequest true "Username and password"
+// @Success 201 {object} User
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 403 {object} anilist.ErrorResponse
+// @Failure 409 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Router /auth/register [post]
+// RegisterHandler handles account registration
+func RegisterHandler(c *gin.Context) {
+	if !RegistrationOpen {
+		c.JSON(403, gin.H{"error": "registration is closed, ask an admin for an account"})
+		return
+	}
+	createUser(c, false)
+}
+
+// CreateUserHandler godoc
+// @Summary Create an account for a user
+// @Description Creates a regular account, also for usernames whose lists were stored before they had an account.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param account body RegisterRequest true "Username and password"
+// @Success 201 {object} User
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 403 {object} anilist.ErrorResponse
+// @Failure 409 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /auth/users [post]
+// CreateUserHandler handles account creation by admins
+func CreateUserHandler(c *gin.Context) {
+	createUser(c, true)
+}
+
+// createUser creates the account of the request body, claim allows usernames owning lists
+func createUser(c *gin.Context, claim bool) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Username == "" {
+		c.JSON(400, gin.H{"error": "username is required"})
+		return
+	}
+	if len(req.Password) < MinPasswordLength {
+		c.JSON(400, gin.H{"error": "password must be at least 8 characters"})
+		return
+	}
+
+	user, err := CreateUser(req.Username, req.Password, claim)
+	if errors.Is(err, ErrUsernameTaken) || errors.Is(err, ErrUsernameOwnsLists) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, user)
+}
+
+// CreateTokenHandler godoc
+// @Summary Create an API key
+// @Description Checks the password of an account and returns a new API key for it. Send it as "Authorization: Bearer <token>".
+// @Description The key is only shown in this response. It may be limited to scopes (items:read, items:write, sync:run, import, tokens, admin)
+// @Description and given an expiry, keys without scopes get all of them. Only admins can create keys with the admin scope.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body TokenRequest true "Username, password and token name"
+// @Success 201 {object} TokenResponse
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 401 {object} anilist.ErrorResponse
+// @Failure 403 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Router /auth/tokens [post]
+// CreateTokenHandler handles API token creation
+func CreateTokenHandler(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	for _, s := range req.Scopes {
+		if !s.Valid() {
+			c.JSON(400, gin.H{"error": "unknown scope: " + string(s)})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	var user User
+	err := db.DB.Where("username = ?", req.Username).Limit(1).Find(&user).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if user.ID == 0 || !CheckPassword(user.PasswordHash, req.Password) {
+		c.JSON(401, gin.H{"error": "wrong username or password"})
+		return
+	}
+
+	if !user.Admin {
+		if slices.Contains(req.Scopes, ScopeAdmin) {
+			c.JSON(403, gin.H{"error": "only admins can create keys with the admin scope"})
+			return
+		}
+		if len(req.Scopes) == 0 {
+			req.Scopes = slices.DeleteFunc(slices.Clone(Scopes), func(s Scope) bool { return s == ScopeAdmin })
+		}
+	}
+
+	token, info, err := NewToken(&user, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(201, TokenResponse{Token: token, Info: info})
+}
+
+// MeHandler godoc
+// @Summary Get the authenticated account
+// @Description Returns the account owning the API token of the request.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} User
+// @Failure 401 {object} anilist.ErrorResponse
+// @Router /auth/me [get]
+// MeHandler handles requests for the caller's account
+func MeHandler(c *gin.Context) {
+	c.JSON(200, Current(c))
+}
+
+// GetTokensHandler godoc
+// @Summary List the caller's API keys
+// @Description Returns the API keys of the account, including revoked and expired ones, newest first. The keys themselves aren't stored.
+// @Description Requires the tokens scope.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} APIToken
+// @Failure 401 {object} anilist.ErrorResponse
+// @Failure 403 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Router /auth/tokens [get]
+// GetTokensHandler handles GET requests for API keys
+func GetTokensHandler(c *gin.Context) {
+	tokens := []APIToken{}
+	if err := db.DB.Where("user_id = ?", Current(c).ID).Order("id DESC").Find(&tokens).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, tokens)
+}
+
+// RevokeTokenHandler godoc
+// @Summary Revoke an API key
+// @Description Revokes one of the caller's API keys, requests with it are rejected from then on. Admins may revoke keys of any account.
+// @Description Requires the tokens scope.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} APIToken
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 401 {object} anilist.ErrorResponse
+// @Failure 403 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 409 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Router /auth/tokens/{id} [delete]
+// RevokeTokenHandler handles revocation of API keys
+func RevokeTokenHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	var t APIToken
+	err = db.DB.First(&t, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && t.UserID != Current(c).ID && !isAdmin(c) {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if t.RevokedAt != nil {
+		c.JSON(409, gin.H{"error": "API key is already revoked"})
+		return
+	}
+
+	now := time.Now()
+	if err := db.DB.Model(&t).Update("revoked_at", now).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, t)
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scope limits what an API key may do
+type Scope string
+
+const (
+	ScopeItemsRead  Scope = "items:read"  // read lists, history, trash and conflicts
+	ScopeItemsWrite Scope = "items:write" // add, edit, delete and restore items, resolve conflicts
+	ScopeSyncRun    Scope = "sync:run"    // start syncs and manage schedules, sync policies, linked accounts and pushes
+	ScopeImport     Scope = "import"      // import list exports
+	ScopeTokens     Scope = "tokens"      // list and revoke the account's API keys
+	ScopeAdmin      Scope = "admin"       // act for other users and run maintenance, grants every other scope
+)
+
+// Scopes lists every known scope, keys created without scopes get all of them
+var Scopes = []Scope{ScopeItemsRead, ScopeItemsWrite, ScopeSyncRun, ScopeImport, ScopeTokens, ScopeAdmin}
+
+// Valid reports whether s is one of the known scopes
+func (s Scope) Valid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// HasScope reports whether an API key grants scope
+// Keys created before scopes existed have none stored and keep full access
+func (t *APIToken) HasScope(scope Scope) bool {
+	if t.Scopes == nil {
+		return true
+	}
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
+
+// currentToken returns the API key resolved by Middleware, or nil outside of it
+func currentToken(c *gin.Context) *APIToken {
+	v, _ := c.Get(tokenKey)
+	t, _ := v.(*APIToken)
+	return t
+}
+
+// isAdmin reports whether the caller is an admin using a key with the admin scope
+func isAdmin(c *gin.Context) bool {
+	user, t := Current(c), currentToken(c)
+	return user != nil && user.Admin && t != nil && t.HasScope(ScopeAdmin)
+}
+
+// RequireScope rejects API keys without scope, it must run after Middleware
+func RequireScope(scope Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t := currentToken(c); t == nil || !t.HasScope(scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "API key lacks the " + string(scope) + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,7 +1,15 @@
 // Package base holds base media declarations
 package base
 
-import "gorm.io/gorm"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type MediaStatus string
 
@@ -13,15 +21,291 @@ const (
 	StatusCompleted     MediaStatus = "Completed"
 	StatusDropped       MediaStatus = "Dropped"
 	StatusPaused        MediaStatus = "Paused"
+	StatusRewatching    MediaStatus = "Rewatching"
+	StatusRereading     MediaStatus = "Rereading"
+
+	// Statuses of games
+	StatusBacklog        MediaStatus = "Backlog"
+	StatusPlaying        MediaStatus = "Playing"
+	StatusBeaten         MediaStatus = "Beaten"         // the main story is finished
+	StatusFullyCompleted MediaStatus = "100% Completed" // everything the game has to offer is done
+	StatusShelved        MediaStatus = "Shelved"
 )
 
+// Valid reports whether s is one of the known media statuses
+func (s MediaStatus) Valid() bool {
+	switch s {
+	case StatusPlanningWatch, StatusWatching, StatusPlanningRead, StatusReading,
+		StatusCompleted, StatusDropped, StatusPaused, StatusRewatching, StatusRereading,
+		StatusBacklog, StatusPlaying, StatusBeaten, StatusFullyCompleted, StatusShelved:
+		return true
+	}
+	return false
+}
+
+// DefaultProvider is the metadata provider assumed for items that don't name one
+const DefaultProvider = "anilist"
+
+// ManualProvider is the provider of items entered by hand, available for every media type
+// They are never looked up, keep the title, total and unit given by the user and get a generated external ID unless given one
+const ManualProvider = "manual"
+
+// PercentUnit is the progress unit of items tracked by percentage, their progress_total is always 100
+const PercentUnit = "percent"
+
 type BaseMedia struct {
 	gorm.Model      `swaggerignore:"true"`
-	Username        string      `json:"username"`
+	Username        string        `json:"username"`
+	Title           string        `json:"title"`
+	Provider        string        `gorm:"default:anilist" json:"provider"`
+	ExternalID      int           `json:"external_id"` // ID of the item at Provider
+	Status          MediaStatus   `json:"status"`
+	ProgressCurrent float64       `json:"progress_current"`
+	ProgressTotal   float64       `json:"progress_total"`
+	ProgressUnit    string        `json:"progress_unit"`                            // ep, ch, percent, min
+	Seasons         []int         `gorm:"serializer:json" json:"seasons,omitempty"` // episodes per season of series tracked in episodes, set by the provider
+	Authors         []string      `gorm:"serializer:json" json:"authors,omitempty"` // set by the provider for books
+	Score           float64       `json:"score"`                                    // 0-100, 0 means unscored
+	RepeatCount     int           `json:"repeat_count"`                             // number of completed rewatches or rereads
+	Notes           string        `json:"notes"`
+	Tags            Tags          `json:"tags"`
+	StartedAt       *time.Time    `json:"started_at"`
+	CompletedAt     *time.Time    `json:"completed_at"`
+	Origin          EventSource   `gorm:"default:manual" json:"origin"` // how the item was added
+	SyncBase        *SyncSnapshot `gorm:"serializer:json" json:"-"`     // provider's copy as of the last sync
+}
+
+// SyncSnapshot is the provider's copy of an item as of the last sync
+type SyncSnapshot struct {
 	Title           string      `json:"title"`
-	ExternalID      int         `json:"external_id"`
 	Status          MediaStatus `json:"status"`
 	ProgressCurrent float64     `json:"progress_current"`
 	ProgressTotal   float64     `json:"progress_total"`
-	ProgressUnit    string      `json:"progress_unit"` // ep, ch, percent, min
+	ProgressUnit    string      `json:"progress_unit"`
+	Score           float64     `json:"score"`
+	RepeatCount     int         `json:"repeat_count"`
+	Notes           string      `json:"notes"`
+	StartedAt       *time.Time  `json:"started_at"`
+	CompletedAt     *time.Time  `json:"completed_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// NewSyncSnapshot takes a snapshot of the synced fields of m
+func NewSyncSnapshot(m BaseMedia) *SyncSnapshot {
+	return &SyncSnapshot{
+		Title:           m.Title,
+		Status:          m.Status,
+		ProgressCurrent: m.ProgressCurrent,
+		ProgressTotal:   m.ProgressTotal,
+		ProgressUnit:    m.ProgressUnit,
+		Score:           m.Score,
+		RepeatCount:     m.RepeatCount,
+		Notes:           m.Notes,
+		StartedAt:       m.StartedAt,
+		CompletedAt:     m.CompletedAt,
+		UpdatedAt:       m.UpdatedAt,
+	}
+}
+
+// Media returns the snapshot as a media item with only the synced fields set
+func (s *SyncSnapshot) Media() BaseMedia {
+	m := BaseMedia{
+		Title:           s.Title,
+		Status:          s.Status,
+		ProgressCurrent: s.ProgressCurrent,
+		ProgressTotal:   s.ProgressTotal,
+		ProgressUnit:    s.ProgressUnit,
+		Score:           s.Score,
+		RepeatCount:     s.RepeatCount,
+		Notes:           s.Notes,
+		StartedAt:       s.StartedAt,
+		CompletedAt:     s.CompletedAt,
+	}
+	m.UpdatedAt = s.UpdatedAt
+	return m
+}
+
+// Media is implemented by every model embedding BaseMedia
+type Media interface {
+	Base() *BaseMedia
+}
+
+// Base returns the embedded BaseMedia
+func (m *BaseMedia) Base() *BaseMedia {
+	return m
+}
+
+// Tags is a list of user defined labels stored as a JSON array
+type Tags []string
+
+// Value implements driver.Valuer
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner
+func (t *Tags) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case []byte:
+		return json.Unmarshal(v, t)
+	}
+	return errors.New("unsupported tags value")
+}
+
+// MediaPatch describes a partial update to a BaseMedia, nil fields are left untouched
+type MediaPatch struct {
+	Title           *string      `json:"title"`
+	Status          *MediaStatus `json:"status"`
+	ProgressCurrent *float64     `json:"progress_current"`
+	ProgressTotal   *float64     `json:"progress_total"`
+	ProgressUnit    *string      `json:"progress_unit"`
+	Score           *float64     `json:"score"`
+	RepeatCount     *int         `json:"repeat_count"`
+	Notes           *string      `json:"notes"`
+	Tags            *Tags        `json:"tags"`
+	StartedAt       *time.Time   `json:"started_at"`
+	CompletedAt     *time.Time   `json:"completed_at"`
+}
+
+// Apply copies the set fields of the patch onto media
+// and returns the changed columns keyed by column name
+func (p MediaPatch) Apply(media *BaseMedia) map[string]any {
+	updates := map[string]any{}
+
+	if p.Title != nil {
+		media.Title = *p.Title
+		updates["title"] = media.Title
+	}
+	if p.Status != nil {
+		media.Status = *p.Status
+		updates["status"] = media.Status
+	}
+	if p.ProgressCurrent != nil {
+		media.ProgressCurrent = *p.ProgressCurrent
+		updates["progress_current"] = media.ProgressCurrent
+	}
+	if p.ProgressTotal != nil {
+		media.ProgressTotal = *p.ProgressTotal
+		updates["progress_total"] = media.ProgressTotal
+	}
+	if p.ProgressUnit != nil {
+		media.ProgressUnit = *p.ProgressUnit
+		updates["progress_unit"] = media.ProgressUnit
+	}
+	if p.Score != nil {
+		media.Score = *p.Score
+		updates["score"] = media.Score
+	}
+	if p.RepeatCount != nil {
+		media.RepeatCount = *p.RepeatCount
+		updates["repeat_count"] = media.RepeatCount
+	}
+	if p.Notes != nil {
+		media.Notes = *p.Notes
+		updates["notes"] = media.Notes
+	}
+	if p.Tags != nil {
+		media.Tags = *p.Tags
+		updates["tags"] = media.Tags
+	}
+	if p.StartedAt != nil {
+		media.StartedAt = p.StartedAt
+		updates["started_at"] = media.StartedAt
+	}
+	if p.CompletedAt != nil {
+		media.CompletedAt = p.CompletedAt
+		updates["completed_at"] = media.CompletedAt
+	}
+
+	return updates
+}
+
+// ErrNoSeasons is returned for season positions of items whose provider didn't report seasons
+var ErrNoSeasons = errors.New("item has no seasons")
+
+// EpisodeOf converts an episode of a season, counted from 1, to progress counted from the first episode of the series
+func (m *BaseMedia) EpisodeOf(season int, episode float64) (float64, error) {
+	if len(m.Seasons) == 0 {
+		return 0, ErrNoSeasons
+	}
+	if season < 1 || season > len(m.Seasons) {
+		return 0, fmt.Errorf("season must be between 1 and %d", len(m.Seasons))
+	}
+	if episode < 0 || episode > float64(m.Seasons[season-1]) {
+		return 0, fmt.Errorf("season %d has %d episodes", season, m.Seasons[season-1])
+	}
+
+	progress := episode
+	for _, count := range m.Seasons[:season-1] {
+		progress += float64(count)
+	}
+	return progress, nil
+}
+
+// SeasonOf returns the season, counted from 1, and the episode within it that progress reaches
+// Items without seasons and progress before the first episode yield 0, 0
+func (m *BaseMedia) SeasonOf(progress float64) (int, float64) {
+	if len(m.Seasons) == 0 || progress <= 0 {
+		return 0, 0
+	}
+	for i, count := range m.Seasons {
+		if progress <= float64(count) || i == len(m.Seasons)-1 {
+			return i + 1, progress
+		}
+		progress -= float64(count)
+	}
+	return 0, 0
+}
+
+// StatusTransition describes a status change caused by a progress update
+type StatusTransition struct {
+	From MediaStatus `json:"from"`
+	To   MediaStatus `json:"to"`
+}
+
+// SetProgress sets the current progress and moves the status along with the statuses of t
+// Planned items become active once progress starts and items reaching ProgressTotal become finished,
+// or complete when tracked in percent, while complete items stay so when they reach another total
+// Finished items falling below ProgressTotal are started again, as repeating if t tracks repeats
+// Repeating items reaching ProgressTotal count another repeat
+// It returns the resulting transition, or nil if the status did not change
+func (m *BaseMedia) SetProgress(value float64, t MediaType) *StatusTransition {
+	from := m.Status
+	m.ProgressCurrent = value
+
+	finished := t.Finished
+	if m.ProgressUnit == PercentUnit && t.Complete != "" {
+		finished = t.Complete
+	}
+
+	switch {
+	case m.ProgressTotal > 0 && value >= m.ProgressTotal && m.Status == t.Complete && t.Complete != "":
+		// a total of hours played doesn't take back a complete status set by hand or a percentage
+	case m.ProgressTotal > 0 && value >= m.ProgressTotal:
+		if m.Status == t.Repeating && t.Repeating != "" {
+			m.RepeatCount++
+		}
+		m.Status = finished
+	case m.Status == finished && m.ProgressTotal > 0:
+		m.Status = t.Active
+		if t.Repeating != "" {
+			m.Status = t.Repeating
+		}
+	case (m.Status == t.Planned() || m.Status == "") && value > 0:
+		m.Status = t.Active
+	}
+
+	if m.Status == from {
+		return nil
+	}
+	return &StatusTransition{From: from, To: m.Status}
 }
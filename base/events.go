@@ -0,0 +1,49 @@
+package base
+
+import "time"
+
+// EventSource tells where a progress change came from
+type EventSource string
+
+const (
+	SourceManual EventSource = "manual"
+	SourceSync   EventSource = "sync"
+	SourceImport EventSource = "import"
+)
+
+// ProgressEvent records a single change of progress or status of a tracked item
+type ProgressEvent struct {
+	ID          uint        `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time   `gorm:"index" json:"created_at"`
+	Username    string      `gorm:"index:idx_progress_events_item" json:"username"`
+	MediaType   string      `gorm:"index:idx_progress_events_item" json:"media_type"`
+	Provider    string      `gorm:"index:idx_progress_events_item;default:anilist" json:"provider"`
+	ExternalID  int         `gorm:"index:idx_progress_events_item" json:"external_id"`
+	Title       string      `json:"title"`
+	OldProgress float64     `json:"old_progress"`
+	NewProgress float64     `json:"new_progress"`
+	OldStatus   MediaStatus `json:"old_status"`
+	NewStatus   MediaStatus `json:"new_status"`
+	Source      EventSource `json:"source"`
+}
+
+// NewProgressEvent describes the change from old to new
+// It returns nil when neither progress nor status changed
+func NewProgressEvent(mediaType string, old, new BaseMedia, source EventSource) *ProgressEvent {
+	if old.ProgressCurrent == new.ProgressCurrent && old.Status == new.Status {
+		return nil
+	}
+
+	return &ProgressEvent{
+		Username:    new.Username,
+		MediaType:   mediaType,
+		Provider:    new.Provider,
+		ExternalID:  new.ExternalID,
+		Title:       new.Title,
+		OldProgress: old.ProgressCurrent,
+		NewProgress: new.ProgressCurrent,
+		OldStatus:   old.Status,
+		NewStatus:   new.Status,
+		Source:      source,
+	}
+}
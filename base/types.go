@@ -0,0 +1,124 @@
+package base
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MediaType declares a kind of tracked media
+// Every registered type gets its own table and is served by the generic /items/{type} routes
+type MediaType struct {
+	Name         string        `json:"name"`            // used in routes and as media_type in the history, conflicts and outbox
+	Table        string        `json:"-"`               // table holding the items of the type
+	ProgressUnit string        `json:"progress_unit"`   // unit of items whose provider doesn't set one
+	Units        []string      `json:"units,omitempty"` // other units items of the type may be tracked in
+	Statuses     []MediaStatus `json:"statuses"`        // statuses items of the type may have, the planned one first
+	Active       MediaStatus   `json:"active"`          // status of items in progress, set by progress updates once progress starts
+	Finished     MediaStatus   `json:"finished"`        // status set by progress updates reaching progress_total, Completed unless set
+	Complete     MediaStatus   `json:"complete"`        // status set instead of Finished when percent progress reaches 100, Finished unless set
+	Repeating    MediaStatus   `json:"repeating"`       // status of finished items started again, such as Rewatching, empty when not tracked
+	Providers    []string      `json:"providers"`       // providers cataloging the type, the first one is the default
+	// ParseID parses catalog IDs given in routes and as external_key, strconv.Atoi when nil
+	// Types whose IDs have their own notation, such as ISBNs of books, validate and normalize them here
+	ParseID func(raw string) (int, error) `json:"-"`
+}
+
+// ParseExternalID parses an external ID of an item of the type from provider
+// Items entered by hand always have plain integer IDs
+func (t MediaType) ParseExternalID(provider, raw string) (int, error) {
+	if t.ParseID != nil && provider != ManualProvider {
+		return t.ParseID(raw)
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id == 0 {
+		return 0, errors.New("external_id must be a non-zero integer")
+	}
+	return id, nil
+}
+
+// Allows reports whether items of the type may have status, the empty status is always allowed
+func (t MediaType) Allows(status MediaStatus) bool {
+	return status == "" || slices.Contains(t.Statuses, status)
+}
+
+// Planned returns the status of items not started yet, the first status of the type
+func (t MediaType) Planned() MediaStatus {
+	if len(t.Statuses) == 0 {
+		return ""
+	}
+	return t.Statuses[0]
+}
+
+// AllowsUnit reports whether items of the type may be tracked in unit
+func (t MediaType) AllowsUnit(unit string) bool {
+	return unit == t.ProgressUnit || slices.Contains(t.Units, unit)
+}
+
+// Supports reports whether a provider catalogs the type
+func (t MediaType) Supports(provider string) bool {
+	return slices.Contains(t.Providers, provider)
+}
+
+// CatalogProvider returns the first provider cataloging the type, skipping the manual provider
+// It returns an empty string when items of the type can only be entered by hand
+func (t MediaType) CatalogProvider() string {
+	for _, p := range t.Providers {
+		if p != ManualProvider {
+			return p
+		}
+	}
+	if len(t.Providers) == 0 {
+		return DefaultProvider
+	}
+	return ""
+}
+
+// DefaultProvider returns the provider assumed for items of the type that don't name one
+func (t MediaType) DefaultProvider() string {
+	if len(t.Providers) == 0 {
+		return DefaultProvider
+	}
+	return t.Providers[0]
+}
+
+var (
+	typesMu sync.RWMutex
+	types   = map[string]MediaType{}
+)
+
+// RegisterMediaType makes a media type available under its name, replacing any previous one
+func RegisterMediaType(t MediaType) {
+	if t.Finished == "" {
+		t.Finished = StatusCompleted
+	}
+	if t.Complete == "" {
+		t.Complete = t.Finished
+	}
+
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	types[t.Name] = t
+}
+
+// LookupMediaType returns the media type registered under name
+func LookupMediaType(name string) (MediaType, bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	t, ok := types[name]
+	return t, ok
+}
+
+// MediaTypes returns all registered media types sorted by name
+func MediaTypes() []MediaType {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	res := make([]MediaType, 0, len(types))
+	for _, t := range types {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
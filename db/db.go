@@ -2,8 +2,15 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
+
+	"everythingtracker/base"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -12,14 +19,225 @@ import (
 
 var DB *gorm.DB
 
-// UpsertMedia performs an upsert operation on any media item
-func UpsertMedia(item any, updateColumns []string) error {
-	return DB.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "username"}, {Name: "external_id"}},
-		DoUpdates: clause.AssignmentColumns(updateColumns),
+// ErrActiveExists is returned when restoring an item whose key is already taken by an active item
+var ErrActiveExists = errors.New("an active item with the same provider and external_id already exists")
+
+// ItemKey identifies a tracked item of a user
+type ItemKey struct {
+	Username   string
+	Provider   string
+	ExternalID int
+}
+
+// Scope limits a query to the item identified by the key
+func (k ItemKey) Scope(tx *gorm.DB) *gorm.DB {
+	return tx.Where("username = ? AND provider = ? AND external_id = ?", k.Username, k.Provider, k.ExternalID)
+}
+
+// activeOnly limits the unique (username, provider, external_id) key to rows that are not soft-deleted
+var activeOnly = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "deleted_at IS NULL"}}}
+
+// UpsertMedia performs an upsert operation on a media item in table within tx
+func UpsertMedia(tx *gorm.DB, table string, item *base.BaseMedia, updateColumns []string) error {
+	return tx.Table(table).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "username"}, {Name: "provider"}, {Name: "external_id"}},
+		TargetWhere: activeOnly,
+		DoUpdates:   clause.AssignmentColumns(updateColumns),
 	}).Create(item).Error
 }
 
+// maxNewIDAttempts bounds the retries of CreateWithNewID when concurrent inserts take the same ID
+const maxNewIDAttempts = 5
+
+// CreateWithNewID inserts item into table within tx under the next external ID of its provider that was never used in table
+// IDs of deleted items are not reused, so their history and trash entries stay apart, and racing inserts are retried
+func CreateWithNewID(tx *gorm.DB, table string, item *base.BaseMedia) error {
+	for attempt := 1; ; attempt++ {
+		var last int
+		err := tx.Table(table).Unscoped().
+			Where("provider = ?", item.Provider).
+			Select("COALESCE(MAX(external_id), 0)").
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		item.ExternalID = last + 1
+		err = tx.Table(table).Create(item).Error
+		if attempt < maxNewIDAttempts && isDuplicate(err) {
+			continue
+		}
+		return err
+	}
+}
+
+// isDuplicate reports whether err is a violation of a unique index
+func isDuplicate(err error) bool {
+	if t, ok := DB.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+		return errors.Is(t.Translate(err), gorm.ErrDuplicatedKey)
+	}
+	return false
+}
+
+// LinkMedia moves an item to another provider and external ID, writing the given columns of item
+// and carrying its progress history over to the new key
+// It returns ErrActiveExists if the user already tracks the item under the new key
+func LinkMedia(table, mediaType string, item *base.BaseMedia, from ItemKey, columns []string) error {
+	to := ItemKey{Username: item.Username, Provider: item.Provider, ExternalID: item.ExternalID}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(table).Model(&base.BaseMedia{}).Scopes(to.Scope).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrActiveExists
+		}
+
+		if err := tx.Table(table).Model(item).Select(append([]string{"provider", "external_id"}, columns...)).Updates(item).Error; err != nil {
+			return err
+		}
+		return tx.Model(&base.ProgressEvent{}).
+			Scopes(from.Scope).
+			Where("media_type = ?", mediaType).
+			Updates(map[string]any{"provider": to.Provider, "external_id": to.ExternalID}).Error
+	})
+}
+
+// BatchSize is the number of rows written per statement by batched inserts
+const BatchSize = 200
+
+// UpsertMediaBatch upserts media items into table within tx, BatchSize rows per statement
+func UpsertMediaBatch(tx *gorm.DB, table string, items []base.BaseMedia, updateColumns []string) error {
+	return tx.Table(table).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "username"}, {Name: "provider"}, {Name: "external_id"}},
+		TargetWhere: activeOnly,
+		DoUpdates:   clause.AssignmentColumns(updateColumns),
+	}).CreateInBatches(&items, BatchSize).Error
+}
+
+// LoadUserMedia loads all active items of a user from one provider in a single query, keyed by external ID
+func LoadUserMedia(tx *gorm.DB, table string, username, provider string) (map[int]base.BaseMedia, error) {
+	var rows []base.BaseMedia
+	err := tx.Table(table).Where("username = ? AND provider = ?", username, provider).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]base.BaseMedia, len(rows))
+	for _, row := range rows {
+		res[row.ExternalID] = row
+	}
+	return res, nil
+}
+
+// DeleteUserMedia soft-deletes the active items of a user from one provider with the given external IDs
+// It returns the number of deleted items
+func DeleteUserMedia(tx *gorm.DB, table string, username, provider string, externalIDs []int) (int64, error) {
+	var deleted int64
+	for ids := range slices.Chunk(externalIDs, BatchSize) {
+		res := tx.Table(table).Where("username = ? AND provider = ? AND external_id IN ?", username, provider, ids).Delete(&base.BaseMedia{})
+		if res.Error != nil {
+			return deleted, res.Error
+		}
+		deleted += res.RowsAffected
+	}
+	return deleted, nil
+}
+
+// FindDeleted loads all soft-deleted media items of a user from table, most recently deleted first
+func FindDeleted(table string, username string) ([]base.BaseMedia, error) {
+	items := []base.BaseMedia{}
+	err := DB.Table(table).Unscoped().
+		Where("username = ? AND deleted_at IS NOT NULL", username).
+		Order("deleted_at DESC").
+		Find(&items).Error
+	return items, err
+}
+
+// RestoreMedia brings back the most recently soft-deleted copy of a media item in table and loads it into item
+// It returns gorm.ErrRecordNotFound if nothing is in the trash and ErrActiveExists
+// if the item has been re-added since it was deleted
+func RestoreMedia(table string, item *base.BaseMedia, key ItemKey) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(table).Model(&base.BaseMedia{}).Scopes(key.Scope).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrActiveExists
+		}
+
+		err := tx.Table(table).Unscoped().
+			Scopes(key.Scope).
+			Where("deleted_at IS NOT NULL").
+			Order("deleted_at DESC").
+			First(item).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Table(table).Unscoped().Model(item).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		item.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+}
+
+// PurgeMedia permanently removes every soft-deleted copy of a media item in table
+func PurgeMedia(table string, key ItemKey) (int64, error) {
+	res := DB.Table(table).Unscoped().
+		Scopes(key.Scope).
+		Where("deleted_at IS NOT NULL").
+		Delete(&base.BaseMedia{})
+	return res.RowsAffected, res.Error
+}
+
+// PurgeDeletedBefore permanently removes media items soft-deleted before cutoff
+// and returns the number of removed rows per media type
+func PurgeDeletedBefore(cutoff time.Time, types ...base.MediaType) (map[string]int64, error) {
+	counts := make(map[string]int64, len(types))
+	for _, t := range types {
+		res := DB.Table(t.Table).Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&base.BaseMedia{})
+		if res.Error != nil {
+			return counts, res.Error
+		}
+		counts[t.Name] = res.RowsAffected
+	}
+	return counts, nil
+}
+
+// StartTrashPurger periodically purges media items that have been in the trash longer than retention until ctx is cancelled
+// The returned channel is closed once the purger has stopped
+func StartTrashPurger(ctx context.Context, retention, interval time.Duration, types ...base.MediaType) <-chan struct{} {
+	purge := func() {
+		counts, err := PurgeDeletedBefore(time.Now().Add(-retention), types...)
+		if err != nil {
+			log.Println("trash purge failed:", err)
+			return
+		}
+		log.Println("trash purge removed", counts)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purge()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
 // InitDatabase initializes the database at the given path
 func InitDatabase(dbPath string) {
 	// Extract directory from path and create if needed
@@ -29,7 +247,9 @@ func InitDatabase(dbPath string) {
 	}
 
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// wait for locks instead of failing, background workers write concurrently with requests
+	// Transactions take the write lock when they begin, a deferred one reading first can't wait for it when it later writes
+	DB, err = gorm.Open(sqlite.Open(dbPath+"?_pragma=busy_timeout(5000)&_txlock=immediate"), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
@@ -38,18 +258,44 @@ func InitDatabase(dbPath string) {
 
 // MigrateModels migrates the provided models into the database
 func MigrateModels(models ...any) error {
-	err := DB.AutoMigrate(models...)
-	if err != nil {
-		return err
-	}
+	return DB.AutoMigrate(models...)
+}
 
-	// Create composite unique indexes for each table
-	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_animes_user_external ON animes(username, external_id)").Error; err != nil {
-		return err
-	}
-	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_mangas_user_external ON mangas(username, external_id)").Error; err != nil {
-		return err
+// backfillOrigin marks existing items of t as synced if they have a sync snapshot or sync history
+func backfillOrigin(t base.MediaType) error {
+	return DB.Exec("UPDATE "+t.Table+" SET origin = ? WHERE sync_base IS NOT NULL OR EXISTS ("+
+		"SELECT 1 FROM progress_events e WHERE e.username = "+t.Table+".username AND e.provider = "+t.Table+".provider"+
+		" AND e.external_id = "+t.Table+".external_id AND e.media_type = ? AND e.source = ?)",
+		base.SourceSync, t.Name, base.SourceSync).Error
+}
+
+// MigrateMediaTypes creates the table of every media type
+// with a unique (username, provider, external_id) index that ignores trashed rows, so a soft-deleted title can be added again
+func MigrateMediaTypes(types ...base.MediaType) error {
+	// Drop the old unique indexes that covered soft-deleted rows or lacked the provider
+	for _, index := range []string{
+		"idx_animes_user_external", "idx_mangas_user_external",
+		"idx_animes_user_external_active", "idx_mangas_user_external_active",
+	} {
+		if err := DB.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
 	}
 
+	for _, t := range types {
+		backfill := DB.Migrator().HasTable(t.Table) && !DB.Migrator().HasColumn(t.Table, "origin")
+		if err := DB.Table(t.Table).AutoMigrate(&base.BaseMedia{}); err != nil {
+			return err
+		}
+		if backfill {
+			if err := backfillOrigin(t); err != nil {
+				return err
+			}
+		}
+		index := "idx_" + t.Table + "_user_provider_external"
+		if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + index + " ON " + t.Table + "(username, provider, external_id) WHERE deleted_at IS NULL").Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"time"
+
+	"everythingtracker/base"
+
+	"gorm.io/gorm"
+)
+
+// RecordProgress stores a progress event within tx, nil events are ignored
+func RecordProgress(tx *gorm.DB, event *base.ProgressEvent) error {
+	if event == nil {
+		return nil
+	}
+	return tx.Create(event).Error
+}
+
+// ItemHistory returns the progress events of a single item, newest first
+func ItemHistory(key ItemKey, mediaType string) ([]base.ProgressEvent, error) {
+	events := []base.ProgressEvent{}
+	err := DB.Scopes(key.Scope).Where("media_type = ?", mediaType).
+		Order("created_at DESC").Order("id DESC").
+		Find(&events).Error
+	return events, err
+}
+
+// UserActivity returns the most recent progress events of a user across all media types
+// A zero since returns events of any age, a limit of 0 returns all of them
+func UserActivity(username string, since time.Time, limit int) ([]base.ProgressEvent, error) {
+	tx := DB.Where("username = ?", username)
+	if !since.IsZero() {
+		tx = tx.Where("created_at >= ?", since)
+	}
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	events := []base.ProgressEvent{}
+	err := tx.Order("created_at DESC").Order("id DESC").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"time"
+
+	"everythingtracker/base"
+
+	"gorm.io/gorm"
+)
+
+// progressRatio orders items by how far along they are, items without a known total sort first
+const progressRatio = "CASE WHEN progress_total > 0 THEN progress_current * 1.0 / progress_total ELSE 0 END"
+
+// MediaQuery describes filtering, sorting and pagination for a media list
+// Zero values disable the corresponding filter
+type MediaQuery struct {
+	Username     string
+	Provider     string
+	Statuses     []base.MediaStatus
+	Title        string
+	ProgressMin  *float64
+	ProgressMax  *float64
+	UpdatedSince *time.Time
+	Tags         []string // items must carry all of them
+	ScoreMin     *float64
+	ScoreMax     *float64
+	Sort         string // title, updated_at, progress or score
+	Desc         bool
+	Limit        int
+	Offset       int
+}
+
+// SortColumns maps the accepted sort keys to their ORDER BY expression
+var SortColumns = map[string]string{
+	"title":      "title",
+	"updated_at": "updated_at",
+	"progress":   progressRatio,
+	"score":      "score",
+}
+
+// filter applies the WHERE part of the query
+func (q MediaQuery) filter(tx *gorm.DB) *gorm.DB {
+	tx = tx.Where("username = ?", q.Username)
+	if q.Provider != "" {
+		tx = tx.Where("provider = ?", q.Provider)
+	}
+	if len(q.Statuses) > 0 {
+		tx = tx.Where("status IN ?", q.Statuses)
+	}
+	if q.Title != "" {
+		tx = tx.Where("title LIKE ?", "%"+q.Title+"%")
+	}
+	if q.ProgressMin != nil {
+		tx = tx.Where("progress_current >= ?", *q.ProgressMin)
+	}
+	if q.ProgressMax != nil {
+		tx = tx.Where("progress_current <= ?", *q.ProgressMax)
+	}
+	if q.UpdatedSince != nil {
+		tx = tx.Where("updated_at >= ?", *q.UpdatedSince)
+	}
+	for _, tag := range q.Tags {
+		tx = tx.Where("EXISTS (SELECT 1 FROM json_each(tags) WHERE json_each.value = ?)", tag)
+	}
+	if q.ScoreMin != nil {
+		tx = tx.Where("score >= ?", *q.ScoreMin)
+	}
+	if q.ScoreMax != nil {
+		tx = tx.Where("score <= ?", *q.ScoreMax)
+	}
+	return tx
+}
+
+// ListMedia loads the page of items in table matching q
+// and returns it with the total number of matching items ignoring pagination
+func ListMedia(table string, q MediaQuery) ([]base.BaseMedia, int64, error) {
+	var total int64
+	if err := q.filter(DB.Table(table).Model(&base.BaseMedia{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	tx := q.filter(DB.Table(table))
+	order := "id"
+	if col, ok := SortColumns[q.Sort]; ok {
+		order = col
+	}
+	if q.Desc {
+		order += " DESC"
+	}
+	tx = tx.Order(order).Order("id")
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	if q.Offset > 0 {
+		tx = tx.Offset(q.Offset)
+	}
+
+	items := []base.BaseMedia{}
+	return items, total, tx.Find(&items).Error
+}
@@ -0,0 +1,131 @@
+// Package goodreads parses Goodreads library CSV exports
+package goodreads
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"everythingtracker/base"
+)
+
+// Entry is a single book of an export
+type Entry struct {
+	BookID      int
+	Title       string
+	Authors     []string
+	ISBN        string // ISBN-13 when the export has one, ISBN-10 otherwise, empty for books without one
+	Pages       float64
+	Shelf       string  // exclusive shelf, such as read, currently-reading or to-read
+	Rating      float64 // 1-5, 0 when unrated
+	CompletedAt *time.Time
+	ReadCount   int
+	Notes       string
+	Tags        []string // the non-exclusive shelves
+}
+
+// columns are the columns of an export read by Parse
+var columns = []string{"Book Id", "Title", "Author", "Additional Authors", "ISBN", "ISBN13", "My Rating", "Number of Pages", "Date Read", "Bookshelves", "Exclusive Shelf", "Private Notes", "Read Count"}
+
+// Parse reads the library export of a Goodreads account
+func Parse(r io.Reader) ([]Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Goodreads export: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range columns {
+		if _, ok := index[name]; !ok {
+			return nil, errors.New("invalid Goodreads export: missing column " + name)
+		}
+	}
+
+	var entries []Entry
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Goodreads export: %w", err)
+		}
+		field := func(name string) string {
+			if i := index[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := Entry{
+			Title:       field("Title"),
+			ISBN:        isbn(field("ISBN13")),
+			Shelf:       field("Exclusive Shelf"),
+			CompletedAt: parseDate(field("Date Read")),
+			Notes:       field("Private Notes"),
+		}
+		if entry.ISBN == "" {
+			entry.ISBN = isbn(field("ISBN"))
+		}
+		entry.BookID, _ = strconv.Atoi(field("Book Id"))
+		entry.Pages, _ = strconv.ParseFloat(field("Number of Pages"), 64)
+		entry.Rating, _ = strconv.ParseFloat(field("My Rating"), 64)
+		entry.ReadCount, _ = strconv.Atoi(field("Read Count"))
+
+		for _, name := range append([]string{field("Author")}, strings.Split(field("Additional Authors"), ",")...) {
+			if name = strings.TrimSpace(name); name != "" {
+				entry.Authors = append(entry.Authors, name)
+			}
+		}
+		for _, shelf := range strings.Split(field("Bookshelves"), ",") {
+			if shelf = strings.TrimSpace(shelf); shelf != "" && shelf != entry.Shelf && !slices.Contains(entry.Tags, shelf) {
+				entry.Tags = append(entry.Tags, shelf)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// isbn strips the ="..." wrapping Goodreads puts around ISBNs to keep spreadsheets from mangling them
+func isbn(raw string) string {
+	return strings.Trim(strings.TrimPrefix(raw, "="), `"`)
+}
+
+// parseDate parses Goodreads' YYYY/MM/DD dates
+func parseDate(raw string) *time.Time {
+	t, err := time.Parse("2006/01/02", raw)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// MapStatus maps the exclusive shelf of a book to internal MediaStatus
+// Besides the three built-in shelves common names of custom exclusive shelves are recognized
+func MapStatus(shelf string) (base.MediaStatus, error) {
+	switch strings.ToLower(shelf) {
+	case "to-read":
+		return base.StatusPlanningRead, nil
+	case "currently-reading":
+		return base.StatusReading, nil
+	case "read":
+		return base.StatusCompleted, nil
+	case "did-not-finish", "dnf", "abandoned":
+		return base.StatusDropped, nil
+	case "on-hold", "paused":
+		return base.StatusPaused, nil
+	}
+	return "", fmt.Errorf("unknown Goodreads shelf %q", shelf)
+}
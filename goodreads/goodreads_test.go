@@ -0,0 +1,77 @@
+package goodreads
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"everythingtracker/base"
+)
+
+const export = "\ufeffBook Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Number of Pages,Date Read,Date Added,Bookshelves,Exclusive Shelf,Private Notes,Read Count\n" +
+	`2767052,The Hunger Games,Suzanne Collins,"Collins, Suzanne",,"=""0439023483""","=""9780439023481""",4,4.34,374,2021/05/09,2021/04/01,"favorites, read",read,gift,2` + "\n" +
+	`11,Good Omens,Terry Pratchett,"Pratchett, Terry",Neil Gaiman,"=""0060853980""","=""""",0,4.25,,,2022/01/02,"to-read, fantasy, fantasy",to-read,,0` + "\n" +
+	`12,Untitled Zine,Anonymous,"Anonymous,",,"=""""","=""""",0,,24,,2022/01/03,,currently-reading,,0` + "\n"
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries", len(entries))
+	}
+
+	e := entries[0]
+	if e.BookID != 2767052 || e.Title != "The Hunger Games" || e.ISBN != "9780439023481" || e.Pages != 374 || e.Rating != 4 || e.ReadCount != 2 {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Shelf != "read" || e.Notes != "gift" || strings.Join(e.Tags, "|") != "favorites" || strings.Join(e.Authors, "|") != "Suzanne Collins" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.CompletedAt == nil || !e.CompletedAt.Equal(time.Date(2021, 5, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("completed at %v", e.CompletedAt)
+	}
+
+	// the ISBN-10 is used when the ISBN13 cell is empty, duplicate shelves are dropped
+	e = entries[1]
+	if e.ISBN != "0060853980" || e.CompletedAt != nil || e.Pages != 0 || strings.Join(e.Authors, "|") != "Terry Pratchett|Neil Gaiman" || strings.Join(e.Tags, "|") != "fantasy" {
+		t.Errorf("entry = %+v", e)
+	}
+
+	if e = entries[2]; e.ISBN != "" || e.Shelf != "currently-reading" || e.Pages != 24 {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, doc := range []string{"", "Book Id,Title\n1,Dune\n", "Title,\"unterminated\n"} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("Parse(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestMapStatus(t *testing.T) {
+	tests := []struct {
+		shelf string
+		want  base.MediaStatus
+	}{
+		{"to-read", base.StatusPlanningRead},
+		{"currently-reading", base.StatusReading},
+		{"read", base.StatusCompleted},
+		{"DNF", base.StatusDropped},
+		{"abandoned", base.StatusDropped},
+		{"on-hold", base.StatusPaused},
+	}
+	for _, tt := range tests {
+		got, err := MapStatus(tt.shelf)
+		if err != nil || got != tt.want {
+			t.Errorf("MapStatus(%q) = %q, %v, want %q", tt.shelf, got, err, tt.want)
+		}
+	}
+
+	if _, err := MapStatus("favorites"); err == nil {
+		t.Error("expected an error for a non-exclusive shelf")
+	}
+}
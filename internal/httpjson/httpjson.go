@@ -0,0 +1,76 @@
+// Package httpjson fetches JSON from the REST APIs of metadata providers
+package httpjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultClient is used by requests without their own HTTP client
+var DefaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxBody bounds the bytes read of a response
+const maxBody = 8 << 20
+
+// StatusError is returned for responses with a status other than 200 OK
+type StatusError struct {
+	Status string // such as 404 Not Found
+	Body   []byte
+}
+
+func (e *StatusError) Error() string {
+	return "responded with " + e.Status
+}
+
+// Request is a GET request of a JSON API
+type Request struct {
+	HTTP    *http.Client // DefaultClient when nil
+	BaseURL string
+	Path    string
+	Params  url.Values
+	Token   string // sent as a bearer token when set
+}
+
+// Get sends r and decodes the JSON response into v
+func Get(r Request, v any) error {
+	u := strings.TrimSuffix(r.BaseURL, "/") + r.Path
+	if len(r.Params) > 0 {
+		u += "?" + r.Params.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+
+	client := r.HTTP
+	if client == nil {
+		client = DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Status: resp.Status, Body: data}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
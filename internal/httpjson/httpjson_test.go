@@ -0,0 +1,47 @@
+package httpjson
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/v1/items" || r.Header.Get("Accept") != "application/json":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"bad token"}`))
+		case r.URL.RawQuery == "":
+			w.Write([]byte(`not json`))
+		default:
+			w.Write([]byte(`{"query":"` + r.URL.Query().Get("q") + `"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var res struct {
+		Query string `json:"query"`
+	}
+	r := Request{BaseURL: srv.URL + "/v1/", Path: "/items", Params: url.Values{"q": {"a b"}}, Token: "secret"}
+	if err := Get(r, &res); err != nil || res.Query != "a b" {
+		t.Errorf("Get = %+v, %v", res, err)
+	}
+
+	r.Token = "wrong"
+	var se *StatusError
+	if err := Get(r, &res); !errors.As(err, &se) || se.Status != "401 Unauthorized" || string(se.Body) != `{"message":"bad token"}` {
+		t.Errorf("unauthorized error = %v", err)
+	} else if err.Error() != "responded with 401 Unauthorized" {
+		t.Errorf("error message = %q", err)
+	}
+
+	r.Token, r.Params = "secret", nil
+	if err := Get(r, &res); err == nil || errors.As(err, &se) {
+		t.Errorf("invalid JSON error = %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"errors"
+	"strconv"
+
+	"everythingtracker/anilist"
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/provider"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterRoutes registers the sync and job routes to the Gin router
+func RegisterRoutes(r *gin.Engine) {
+	api := r.Group("", auth.Middleware(), auth.RequireScope(auth.ScopeSyncRun))
+	api.POST("/sync/:provider/:type", SyncHandler)
+	api.GET("/jobs/:id", GetJobHandler)
+}
+
+// SyncHandler godoc
+// @Summary Start a sync of a user list from a provider
+// @Description Queues a job that fetches a user's list of the given media type from the provider and upserts all entries
+// @Description into the local database. Entries added by an earlier sync that are no longer on the provider's list are
+// @Description soft-deleted, or only reported in the job when prune is false. Manually added entries are never removed.
+// @Description Entries from before origins were tracked only count as synced if a sync snapshot or sync history exists for them.
+// @Description Poll GET /jobs/{id} for its state. Only one sync per user and media type runs at a time.
+// @Description With dry_run the list is fetched and compared right away and the diff is returned without writing anything.
+// @Description The list of the user's account at the provider is synced, set it with PUT /accounts/{provider} first.
+// @Tags sync
+// @Produce json
+// @Param provider path string true "Metadata provider" default(anilist)
+// @Param type path string true "Media type, see GET /types" default(anime)
+// @Param username query string false "Local user whose list is synced, defaults to the caller"
+// @Param prune query bool false "Soft-delete synced entries missing from the provider's list" default(true)
+// @Param policy query string false "Conflict policy, defaults to the user's policy" Enums(remote-wins, local-wins, newest-wins, max-progress-wins, field-merge)
+// @Param dry_run query bool false "Return the changes the sync would make instead of queueing it"
+// @Success 200 {object} anilist.SyncDiff "Dry run"
+// @Success 202 {object} Job
+// @Header 202 {string} Location "URL of the job"
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 409 {object} Job
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /sync/{provider}/{type} [post]
+// SyncHandler handles sync requests for any registered provider
+func SyncHandler(c *gin.Context) {
+	p, err := provider.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error() + ": " + c.Param("provider")})
+		return
+	}
+
+	mediaType := c.Param("type")
+	if _, ok := base.LookupMediaType(mediaType); !ok {
+		c.JSON(404, gin.H{"error": "unknown media type: " + mediaType})
+		return
+	}
+
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+	if _, err := anilist.AccountName(username, p.Name()); err != nil {
+		status := 500
+		if errors.Is(err, anilist.ErrNoAccount) {
+			status = 400
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	prune, err := strconv.ParseBool(c.DefaultQuery("prune", "true"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "prune must be true or false"})
+		return
+	}
+
+	opts := anilist.SyncOptions{Prune: prune, Policy: anilist.ConflictPolicy(c.Query("policy"))}
+	if opts.Policy != "" && !opts.Policy.Valid() {
+		c.JSON(400, gin.H{"error": "unknown conflict policy: " + string(opts.Policy)})
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	if dryRun {
+		if opts.Policy == "" {
+			if opts.Policy, err = anilist.UserPolicy(username, p.Name()); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		data, err := fetchList(p, mediaType, username)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		diff, err := anilist.DiffUserList(p.Name(), mediaType, username, data, opts)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, diff)
+		return
+	}
+
+	job, err := Enqueue(username, p.Name(), mediaType, opts)
+	if errors.Is(err, ErrActive) {
+		c.Header("Location", "/jobs/"+strconv.FormatUint(uint64(job.ID), 10))
+		c.JSON(409, job)
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/jobs/"+strconv.FormatUint(uint64(job.ID), 10))
+	c.JSON(202, job)
+}
+
+// GetJobHandler godoc
+// @Summary Get a sync job
+// @Description Returns the state of a sync job with the number of entries processed, created, updated, skipped and deleted,
+// @Description and the external IDs of entries missing from the provider's list.
+// @Tags sync
+// @Produce json
+// @Param id path int true "Job ID"
+// @Success 200 {object} Job
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /jobs/{id} [get]
+// GetJobHandler handles job status requests
+func GetJobHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	job, err := Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := auth.Username(c, job.Username); !ok {
+		return
+	}
+
+	c.JSON(200, job)
+}
@@ -0,0 +1,246 @@
+// Package jobs runs provider syncs asynchronously on a bounded worker pool backed by SQLite
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"everythingtracker/anilist"
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/provider"
+)
+
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+)
+
+// ErrActive is returned when a sync for the same user, provider and media type is already queued or running
+var ErrActive = errors.New("a sync for this user and media type is already queued or running")
+
+// pollInterval is how often idle workers look for queued jobs they were not woken up for
+const pollInterval = 5 * time.Second
+
+// Job is a single sync of a user list from a provider
+type Job struct {
+	ID         uint                   `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	Username   string                 `json:"username"`
+	Provider   string                 `json:"provider"`
+	MediaType  string                 `json:"media_type"`
+	Prune      bool                   `json:"prune"`  // soft-delete synced entries missing from the provider's list
+	Policy     anilist.ConflictPolicy `json:"policy"` // the user's policy is used when empty
+	State      State                  `gorm:"index" json:"state"`
+	Processed  int                    `json:"processed"`
+	Created    int                    `json:"created"`
+	Updated    int                    `json:"updated"`
+	Skipped    int                    `json:"skipped"`
+	Deleted    int                    `json:"deleted"`
+	Conflicts  int                    `json:"conflicts"`
+	Removed    []int                  `gorm:"serializer:json" json:"removed"` // external IDs missing from the provider's list
+	Error      string                 `json:"error"`
+	StartedAt  *time.Time             `json:"started_at"`
+	FinishedAt *time.Time             `json:"finished_at"`
+}
+
+// TableName sets the table name for sync jobs
+func (Job) TableName() string {
+	return "sync_jobs"
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j Job) Done() bool {
+	return j.State == StateSucceeded || j.State == StateFailed
+}
+
+// Migrate creates the job table and the index allowing a single active job per user list
+func Migrate() error {
+	if err := db.DB.AutoMigrate(&Job{}); err != nil {
+		return err
+	}
+	return db.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_jobs_active ON sync_jobs(username, provider, media_type) WHERE state IN ('queued', 'running')").Error
+}
+
+// wake nudges an idle worker when a job is queued
+var wake = make(chan struct{}, 1)
+
+// Enqueue queues a sync job with the given options, an empty policy selects the user's policy when the job runs
+// If a job for the same list is already queued or running it is returned together with ErrActive
+func Enqueue(username, providerName, mediaType string, opts anilist.SyncOptions) (*Job, error) {
+	job := Job{Username: username, Provider: providerName, MediaType: mediaType, Prune: opts.Prune, Policy: opts.Policy, State: StateQueued}
+	if err := db.DB.Create(&job).Error; err != nil {
+		var active Job
+		if db.DB.Where("username = ? AND provider = ? AND media_type = ? AND state IN ?",
+			username, providerName, mediaType, []State{StateQueued, StateRunning}).First(&active).Error == nil {
+			return &active, ErrActive
+		}
+		return nil, err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return &job, nil
+}
+
+// Get loads a job by ID
+func Get(id uint) (*Job, error) {
+	var job Job
+	if err := db.DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Start requeues jobs interrupted by a previous shutdown and runs workers until ctx is cancelled
+// Running jobs are finished before the workers stop, the returned channel is closed once all have stopped
+func Start(ctx context.Context, workers int) <-chan struct{} {
+	err := db.DB.Model(&Job{}).Where("state = ?", StateRunning).
+		Updates(map[string]any{"state": StateQueued, "started_at": nil}).Error
+	if err != nil {
+		log.Println("jobs: failed to requeue interrupted jobs:", err)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{}, workers)
+	for range workers {
+		go func() {
+			work(ctx)
+			stopped <- struct{}{}
+		}()
+	}
+	go func() {
+		for range workers {
+			<-stopped
+		}
+		close(done)
+	}()
+
+	return done
+}
+
+// work runs queued jobs one at a time until ctx is cancelled
+func work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := claim()
+			if err != nil {
+				log.Println("jobs: failed to claim job:", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			run(job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest queued job as running and returns it, or nil if none is queued
+func claim() (*Job, error) {
+	var job Job
+	for {
+		job = Job{}
+		if err := db.DB.Where("state = ?", StateQueued).Order("id").Limit(1).Find(&job).Error; err != nil {
+			return nil, err
+		}
+		if job.ID == 0 {
+			return nil, nil
+		}
+
+		now := time.Now()
+		res := db.DB.Model(&Job{}).Where("id = ? AND state = ?", job.ID, StateQueued).
+			Updates(map[string]any{"state": StateRunning, "started_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			job.State, job.StartedAt = StateRunning, &now
+			return &job, nil
+		}
+		// another worker claimed it first, try the next one
+	}
+}
+
+// run performs the sync of a claimed job and stores the outcome
+func run(job *Job) {
+	stats, err := syncList(job)
+
+	now := time.Now()
+	job.Processed, job.Created, job.Updated, job.Skipped = stats.Processed, stats.Created, stats.Updated, stats.Skipped
+	job.Deleted, job.Conflicts, job.Removed = stats.Deleted, stats.Conflicts, stats.Removed
+	job.FinishedAt = &now
+	job.State = StateSucceeded
+	if err != nil {
+		job.State, job.Error = StateFailed, err.Error()
+		log.Println("jobs: sync", job.ID, "failed:", err)
+	}
+
+	if err := db.DB.Save(job).Error; err != nil {
+		log.Println("jobs: failed to save job", job.ID, err)
+	}
+}
+
+// syncList fetches and applies the user list of a job
+// A panic in provider code fails the job instead of the server, which would requeue and run it again on restart
+func syncList(job *Job) (stats anilist.SyncStats, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("jobs: sync %d panicked: %v\n%s", job.ID, r, debug.Stack())
+			stats, err = anilist.SyncStats{}, fmt.Errorf("sync panicked: %v", r)
+		}
+	}()
+
+	p, err := provider.Get(job.Provider)
+	if err != nil {
+		return anilist.SyncStats{}, errors.New(err.Error() + ": " + job.Provider)
+	}
+
+	if job.Policy == "" {
+		if job.Policy, err = anilist.UserPolicy(job.Username, p.Name()); err != nil {
+			return anilist.SyncStats{}, err
+		}
+	}
+
+	data, err := fetchList(p, job.MediaType, job.Username)
+	if err != nil {
+		return anilist.SyncStats{}, err
+	}
+
+	return anilist.ApplyUserList(p.Name(), job.MediaType, job.Username, data, anilist.SyncOptions{Prune: job.Prune, Policy: job.Policy})
+}
+
+// fetchList fetches the list of the given media type of a user's account at a provider
+func fetchList(p provider.Provider, mediaType, username string) ([]base.BaseMedia, error) {
+	account, err := anilist.AccountName(username, p.Name())
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.FetchUserList(mediaType, username, account)
+	if err != nil {
+		return nil, errors.New("failed to fetch " + mediaType + " list from " + p.Name() + ": " + strings.TrimSpace(err.Error()))
+	}
+	return data, nil
+}
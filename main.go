@@ -3,11 +3,29 @@ package main
 //go:generate go run github.com/swaggo/swag/cmd/swag@latest init -g main.go -o docs --outputTypes go
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"everythingtracker/anilist"
+	"everythingtracker/auth"
+	"everythingtracker/base"
 	"everythingtracker/db"
+	"everythingtracker/jobs"
+	"everythingtracker/mal"
+	"everythingtracker/openlibrary"
+	"everythingtracker/provider"
+	"everythingtracker/push"
+	"everythingtracker/rawg"
+	"everythingtracker/scheduler"
+	"everythingtracker/tmdb"
 	_ "everythingtracker/docs"
 
 	"github.com/gin-gonic/gin"
@@ -17,22 +35,92 @@ import (
 
 // @title Everything Tracker API
 // @version 1.0
-// @description REST API for tracking anime and manga data, with AniList sync and search support.
+// @description REST API for tracking anime, manga, movies, TV series, books and games, with AniList, TMDB and RAWG sync and search support.
 // @BasePath /
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description API token created with POST /auth/tokens, sent as "Bearer <token>"
+
 func main() {
 	db.InitDatabase("data/tracker.sqlite")
-	err := db.MigrateModels(&anilist.Anime{}, &anilist.Manga{})
+	anilist.RegisterMediaTypes()
+	tmdb.RegisterMediaTypes()
+	openlibrary.RegisterMediaTypes()
+	rawg.RegisterMediaTypes()
+	err := db.MigrateModels(&base.ProgressEvent{}, &scheduler.Schedule{}, &anilist.Token{}, &anilist.ShareLink{}, &auth.User{}, &auth.APIToken{})
 	if err != nil {
 		panic("failed to migrate database")
 	}
+	if err := db.MigrateMediaTypes(base.MediaTypes()...); err != nil {
+		panic("failed to migrate database")
+	}
+	if err := anilist.MigrateSync(); err != nil {
+		panic("failed to migrate database")
+	}
+	if err := jobs.Migrate(); err != nil {
+		panic("failed to migrate database")
+	}
+	if err := push.Migrate(); err != nil {
+		panic("failed to migrate database")
+	}
+
+	// Items that have been in the trash for longer are permanently removed, 0 keeps them forever
+	retentionDays := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		retentionDays, err = strconv.Atoi(v)
+		if err != nil {
+			panic("invalid TRASH_RETENTION_DAYS")
+		}
+	}
+
+	// Anyone may register when OPEN_REGISTRATION is set, otherwise admins create accounts
+	if v := os.Getenv("OPEN_REGISTRATION"); v != "" {
+		auth.RegistrationOpen, err = strconv.ParseBool(v)
+		if err != nil {
+			panic("invalid OPEN_REGISTRATION")
+		}
+	}
+
+	// The admin account, created or promoted once while no admin exists
+	if v := os.Getenv("ADMIN_USERNAME"); v != "" {
+		if err := auth.EnsureAdmin(v, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			panic("failed to set up the admin account: " + err.Error())
+		}
+	}
+
+	// Optional offline MyAnimeList to AniList ID table for imports
+	if path := os.Getenv("MAL_ID_MAP"); path != "" {
+		mal.IDMap, err = mal.LoadMapping(path)
+		if err != nil {
+			panic("failed to load MAL_ID_MAP: " + err.Error())
+		}
+	}
+
+	// AniList account linking, the key encrypts stored access tokens
+	anilist.GraphQLEndpoint = os.Getenv("ANILIST_GRAPHQL_URL")
+	anilist.OAuth.ClientID = os.Getenv("ANILIST_CLIENT_ID")
+	anilist.OAuth.ClientSecret = os.Getenv("ANILIST_CLIENT_SECRET")
+	anilist.OAuth.RedirectURL = os.Getenv("ANILIST_REDIRECT_URL")
+	if v := os.Getenv("ANILIST_AUTH_URL"); v != "" {
+		anilist.OAuth.AuthURL = v
+	}
+	if v := os.Getenv("ANILIST_TOKEN_URL"); v != "" {
+		anilist.OAuth.TokenURL = v
+	}
+	if v := os.Getenv("TOKEN_ENCRYPTION_KEY"); v != "" {
+		if err := anilist.SetTokenKey(v); err != nil {
+			panic("invalid TOKEN_ENCRYPTION_KEY: " + err.Error())
+		}
+	}
 
 	r := gin.Default()
 	
 	// Add CORS middleware to allow Swagger UI requests
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		
 		if c.Request.Method == "OPTIONS" {
@@ -43,15 +131,69 @@ func main() {
 		c.Next()
 	})
 	
+	provider.Register(anilist.Provider{})
+	// TMDB_API_URL points movie and series lookups at another TMDB compatible API
+	provider.Register(tmdb.Provider{Client: &tmdb.Client{BaseURL: os.Getenv("TMDB_API_URL"), Token: os.Getenv("TMDB_TOKEN")}})
+	// OPENLIBRARY_URL points book lookups at another Open Library compatible API
+	provider.Register(openlibrary.Provider{Client: &openlibrary.Client{BaseURL: os.Getenv("OPENLIBRARY_URL")}})
+	// RAWG_API_URL points game lookups at another RAWG compatible catalog
+	provider.Register(rawg.Provider{Client: &rawg.Client{BaseURL: os.Getenv("RAWG_API_URL"), Key: os.Getenv("RAWG_API_KEY")}})
+	auth.RegisterRoutes(r)
 	anilist.RegisterRoutes(r)
+	jobs.RegisterRoutes(r)
+	scheduler.RegisterRoutes(r)
+	push.RegisterRoutes(r)
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Stop the server and background workers on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := 2
+	if v := os.Getenv("SYNC_WORKERS"); v != "" {
+		workers, err = strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			panic("invalid SYNC_WORKERS")
+		}
+	}
+
+	// Permanently remove items that have been in the trash for too long
+	var purgerDone <-chan struct{}
+	if retentionDays > 0 {
+		purgerDone = db.StartTrashPurger(ctx, time.Duration(retentionDays)*24*time.Hour, time.Hour, base.MediaTypes()...)
+	}
+
+	jobsDone := jobs.Start(ctx, workers)
+	schedulerDone := scheduler.Start(ctx, time.Minute)
+
+	// Send local edits to AniList, ANILIST_GRAPHQL_URL points the pusher at another GraphQL server
+	pusher := &push.Pusher{Endpoint: os.Getenv("ANILIST_GRAPHQL_URL"), Token: anilist.UserToken}
+	pushDone := pusher.Start(ctx, 30*time.Second)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	err = r.Run(fmt.Sprintf(":%s", port))
-	if err != nil {
-		panic("failed to start server")
+	srv := &http.Server{Addr: fmt.Sprintf(":%s", port), Handler: r}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic("failed to start server")
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("server shutdown:", err)
+	}
+	if purgerDone != nil {
+		<-purgerDone
 	}
+	<-schedulerDone
+	<-pushDone
+	<-jobsDone
 }
@@ -0,0 +1,192 @@
+// Package mal parses MyAnimeList XML list exports and maps MyAnimeList IDs to AniList IDs
+package mal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"everythingtracker/base"
+)
+
+// Media types of an export, matching the route names
+const (
+	MediaTypeAnime = "anime"
+	MediaTypeManga = "manga"
+)
+
+// Entry is a single list row of an export, normalized across anime and manga
+type Entry struct {
+	MalID       int
+	Title       string
+	Status      string
+	Progress    float64
+	Total       float64 // 0 when MyAnimeList doesn't know the length
+	Score       float64 // 0-10
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+	Repeat      int
+	Notes       string
+	Tags        []string
+}
+
+type export struct {
+	Info struct {
+		ExportType int `xml:"user_export_type"`
+	} `xml:"myinfo"`
+	Anime []animeEntry `xml:"anime"`
+	Manga []mangaEntry `xml:"manga"`
+}
+
+type animeEntry struct {
+	ID       int     `xml:"series_animedb_id"`
+	Title    string  `xml:"series_title"`
+	Episodes float64 `xml:"series_episodes"`
+	Watched  float64 `xml:"my_watched_episodes"`
+	listFields
+	TimesWatched int `xml:"my_times_watched"`
+}
+
+type mangaEntry struct {
+	ID       int     `xml:"manga_mangadb_id"`
+	Title    string  `xml:"manga_title"`
+	Chapters float64 `xml:"manga_chapters"`
+	Read     float64 `xml:"my_read_chapters"`
+	listFields
+	TimesRead int `xml:"my_times_read"`
+}
+
+type listFields struct {
+	StartDate  string  `xml:"my_start_date"`
+	FinishDate string  `xml:"my_finish_date"`
+	Score      float64 `xml:"my_score"`
+	Status     string  `xml:"my_status"`
+	Comments   string  `xml:"my_comments"`
+	Tags       string  `xml:"my_tags"`
+}
+
+// Parse reads an animelist.xml or mangalist.xml export and returns its media type and entries
+func Parse(r io.Reader) (string, []Entry, error) {
+	var doc export
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("invalid MyAnimeList export: %w", err)
+	}
+
+	switch {
+	case len(doc.Manga) > 0 || doc.Info.ExportType == 2:
+		entries := make([]Entry, 0, len(doc.Manga))
+		for _, m := range doc.Manga {
+			entry := m.listFields.entry()
+			entry.MalID, entry.Title = m.ID, strings.TrimSpace(m.Title)
+			entry.Progress, entry.Total, entry.Repeat = m.Read, m.Chapters, m.TimesRead
+			entries = append(entries, entry)
+		}
+		return MediaTypeManga, entries, nil
+	case len(doc.Anime) > 0 || doc.Info.ExportType == 1:
+		entries := make([]Entry, 0, len(doc.Anime))
+		for _, a := range doc.Anime {
+			entry := a.listFields.entry()
+			entry.MalID, entry.Title = a.ID, strings.TrimSpace(a.Title)
+			entry.Progress, entry.Total, entry.Repeat = a.Watched, a.Episodes, a.TimesWatched
+			entries = append(entries, entry)
+		}
+		return MediaTypeAnime, entries, nil
+	}
+
+	return "", nil, errors.New("invalid MyAnimeList export: no anime or manga entries")
+}
+
+// entry converts the fields shared by anime and manga rows
+func (f listFields) entry() Entry {
+	entry := Entry{
+		Status:      strings.TrimSpace(f.Status),
+		Score:       f.Score,
+		StartedAt:   parseDate(f.StartDate),
+		CompletedAt: parseDate(f.FinishDate),
+		Notes:       strings.TrimSpace(f.Comments),
+	}
+	for _, tag := range strings.Split(f.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+	return entry
+}
+
+// parseDate parses MyAnimeList's YYYY-MM-DD dates where unknown parts are zero
+func parseDate(raw string) *time.Time {
+	parts := strings.Split(strings.TrimSpace(raw), "-")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	year, _ := strconv.Atoi(parts[0])
+	month, _ := strconv.Atoi(parts[1])
+	day, _ := strconv.Atoi(parts[2])
+	if year == 0 {
+		return nil
+	}
+	month, day = max(month, 1), max(day, 1)
+
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+// MapStatus maps a MyAnimeList list status, either by name or numeric code, to internal MediaStatus
+func MapStatus(status string, isAnime bool) (base.MediaStatus, error) {
+	switch strings.ToLower(status) {
+	case "watching", "reading", "1":
+		if isAnime {
+			return base.StatusWatching, nil
+		}
+		return base.StatusReading, nil
+	case "completed", "2":
+		return base.StatusCompleted, nil
+	case "on-hold", "3":
+		return base.StatusPaused, nil
+	case "dropped", "4":
+		return base.StatusDropped, nil
+	case "plan to watch", "plan to read", "6":
+		if isAnime {
+			return base.StatusPlanningWatch, nil
+		}
+		return base.StatusPlanningRead, nil
+	}
+	return "", fmt.Errorf("unknown MyAnimeList status %q", status)
+}
+
+// Mapping is an offline table of MyAnimeList IDs to AniList IDs per media type
+type Mapping struct {
+	Anime map[int]int `json:"anime"`
+	Manga map[int]int `json:"manga"`
+}
+
+// IDMap is the offline mapping used by imports, empty unless loaded at startup
+var IDMap Mapping
+
+// LoadMapping reads a JSON mapping file of the form {"anime": {"<mal id>": <anilist id>}, "manga": {...}}
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Lookup returns the AniList ID mapped to a MyAnimeList ID
+func (m Mapping) Lookup(mediaType string, malID int) (int, bool) {
+	table := m.Anime
+	if mediaType == MediaTypeManga {
+		table = m.Manga
+	}
+	id, ok := table[malID]
+	return id, ok
+}
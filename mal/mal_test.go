@@ -0,0 +1,110 @@
+package mal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"everythingtracker/base"
+)
+
+const animeExport = `<?xml version="1.0" encoding="UTF-8" ?>
+<myanimelist>
+	<myinfo><user_export_type>1</user_export_type></myinfo>
+	<anime>
+		<series_animedb_id>5114</series_animedb_id>
+		<series_title><![CDATA[ Fullmetal Alchemist: Brotherhood ]]></series_title>
+		<series_episodes>64</series_episodes>
+		<my_watched_episodes>64</my_watched_episodes>
+		<my_start_date>2020-03-00</my_start_date>
+		<my_finish_date>0000-00-00</my_finish_date>
+		<my_score>10</my_score>
+		<my_status>Completed</my_status>
+		<my_comments><![CDATA[rewatch soon]]></my_comments>
+		<my_times_watched>1</my_times_watched>
+		<my_tags><![CDATA[action, , classic]]></my_tags>
+	</anime>
+</myanimelist>`
+
+const mangaExport = `<myanimelist>
+	<myinfo><user_export_type>2</user_export_type></myinfo>
+	<manga>
+		<manga_mangadb_id>2</manga_mangadb_id>
+		<manga_title>Berserk</manga_title>
+		<manga_chapters>0</manga_chapters>
+		<my_read_chapters>120</my_read_chapters>
+		<my_status>1</my_status>
+		<my_times_read>0</my_times_read>
+	</manga>
+</myanimelist>`
+
+func TestParseAnime(t *testing.T) {
+	mediaType, entries, err := Parse(strings.NewReader(animeExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeAnime || len(entries) != 1 {
+		t.Fatalf("got %s with %d entries", mediaType, len(entries))
+	}
+
+	e := entries[0]
+	if e.MalID != 5114 || e.Title != "Fullmetal Alchemist: Brotherhood" || e.Progress != 64 || e.Total != 64 || e.Score != 10 || e.Repeat != 1 {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Status != "Completed" || e.Notes != "rewatch soon" || strings.Join(e.Tags, "|") != "action|classic" {
+		t.Errorf("entry = %+v", e)
+	}
+	// an unknown day falls back to the first, an unknown date is left out
+	if e.StartedAt == nil || !e.StartedAt.Equal(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)) || e.CompletedAt != nil {
+		t.Errorf("dates = %v, %v", e.StartedAt, e.CompletedAt)
+	}
+}
+
+func TestParseManga(t *testing.T) {
+	mediaType, entries, err := Parse(strings.NewReader(mangaExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeManga || len(entries) != 1 {
+		t.Fatalf("got %s with %d entries", mediaType, len(entries))
+	}
+	if e := entries[0]; e.MalID != 2 || e.Progress != 120 || e.Total != 0 || e.Status != "1" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, doc := range []string{"", "not xml", "<myanimelist><myinfo></myinfo></myanimelist>"} {
+		if _, _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("Parse(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestMapStatus(t *testing.T) {
+	tests := []struct {
+		status  string
+		isAnime bool
+		want    base.MediaStatus
+	}{
+		{"Watching", true, base.StatusWatching},
+		{"Reading", false, base.StatusReading},
+		{"1", false, base.StatusReading},
+		{"Completed", true, base.StatusCompleted},
+		{"2", false, base.StatusCompleted},
+		{"On-Hold", true, base.StatusPaused},
+		{"Dropped", false, base.StatusDropped},
+		{"Plan to Watch", true, base.StatusPlanningWatch},
+		{"6", false, base.StatusPlanningRead},
+	}
+	for _, tt := range tests {
+		got, err := MapStatus(tt.status, tt.isAnime)
+		if err != nil || got != tt.want {
+			t.Errorf("MapStatus(%q, %v) = %q, %v, want %q", tt.status, tt.isAnime, got, err, tt.want)
+		}
+	}
+
+	if _, err := MapStatus("5", true); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+}
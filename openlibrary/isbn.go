@@ -0,0 +1,77 @@
+package openlibrary
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidISBN is returned for ISBNs with a wrong length, stray characters or a wrong check digit
+var ErrInvalidISBN = errors.New("invalid ISBN")
+
+// NormalizeISBN validates an ISBN-10 or ISBN-13, optionally with dashes and spaces, and returns it as ISBN-13
+// Digits-only ISBN-10s shorter than 10 characters are taken to have lost their leading zeros
+func NormalizeISBN(raw string) (string, error) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(raw)))
+	if len(isbn) < 10 && isbn != "" && strings.Trim(isbn, "0123456789") == "" {
+		isbn = strings.Repeat("0", 10-len(isbn)) + isbn
+	}
+
+	switch len(isbn) {
+	case 10:
+		if !validISBN10(isbn) {
+			return "", ErrInvalidISBN
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + strconv.Itoa(checkDigit13(isbn)), nil
+	case 13:
+		if strings.Trim(isbn, "0123456789") != "" || checkDigit13(isbn[:12]) != int(isbn[12]-'0') {
+			return "", ErrInvalidISBN
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "", ErrInvalidISBN
+		}
+		return isbn, nil
+	}
+	return "", ErrInvalidISBN
+}
+
+// ParseISBN normalizes an ISBN and returns the ISBN-13 as a number, the external ID of books
+func ParseISBN(raw string) (int, error) {
+	isbn, err := NormalizeISBN(raw)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(isbn)
+}
+
+// validISBN10 checks the characters and check digit of an ISBN-10, only the last may be X
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i := range 10 {
+		var d int
+		switch c := isbn[i]; {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// checkDigit13 computes the check digit of the first 12 digits of an ISBN-13
+func checkDigit13(digits string) int {
+	sum := 0
+	for i := range 12 {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
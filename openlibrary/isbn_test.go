@@ -0,0 +1,55 @@
+package openlibrary
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"9780306406157", "9780306406157"},
+		{"978-0-306-40615-7", "9780306406157"},
+		{" 978 0 306 40615 7 ", "9780306406157"},
+		{"0306406152", "9780306406157"},
+		{"0-306-40615-2", "9780306406157"},
+		{"306406152", "9780306406157"}, // leading zero lost to a spreadsheet
+		{"080442957X", "9780804429573"},
+		{"0-8044-2957-x", "9780804429573"},
+		{"979-10-347-3230-2", "9791034732302"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeISBN(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeISBNInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"0306406153",    // wrong ISBN-10 check digit
+		"9780306406158", // wrong ISBN-13 check digit
+		"X306406152",    // X before the check digit
+		"03064061520",   // 11 digits
+		"9770306406155", // neither 978 nor 979
+		"978030640615X",
+		"isbn0306406152",
+	} {
+		if got, err := NormalizeISBN(raw); !errors.Is(err, ErrInvalidISBN) {
+			t.Errorf("NormalizeISBN(%q) = %q, %v, want ErrInvalidISBN", raw, got, err)
+		}
+	}
+}
+
+func TestParseISBN(t *testing.T) {
+	if id, err := ParseISBN("0-8044-2957-X"); err != nil || id != 9780804429573 {
+		t.Errorf("ParseISBN = %d, %v", id, err)
+	}
+	if _, err := ParseISBN("0306406153"); !errors.Is(err, ErrInvalidISBN) {
+		t.Errorf("ParseISBN of an invalid ISBN = %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package openlibrary tracks books with metadata from Open Library or a compatible API, identified by ISBN-13
+package openlibrary
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"everythingtracker/base"
+	"everythingtracker/internal/httpjson"
+)
+
+// Name is the provider name of Open Library
+const Name = "openlibrary"
+
+// DefaultBaseURL is the Open Library API
+const DefaultBaseURL = "https://openlibrary.org"
+
+// MediaTypeBook is the media type name used in routes and the progress history
+const MediaTypeBook = "book"
+
+// BookType is the media type of books, registered by RegisterMediaTypes
+// Books are tracked in pages or percent and identified by their ISBN-13
+var BookType = base.MediaType{
+	Name:         MediaTypeBook,
+	Table:        "books",
+	ProgressUnit: "page",
+	Units:        []string{base.PercentUnit},
+	Statuses:     []base.MediaStatus{base.StatusPlanningRead, base.StatusReading, base.StatusCompleted, base.StatusDropped, base.StatusPaused, base.StatusRereading},
+	Active:       base.StatusReading,
+	Repeating:    base.StatusRereading,
+	Providers:    []string{Name},
+	ParseID:      ParseISBN,
+}
+
+// RegisterMediaTypes registers books
+func RegisterMediaTypes() {
+	base.RegisterMediaType(BookType)
+}
+
+// ErrNotFound is returned by Details for ISBNs unknown to Open Library
+var ErrNotFound = errors.New("openlibrary: no book with this ISBN")
+
+// edition is a book as returned by the books API with jscmd=data
+type edition struct {
+	Title   string `json:"title"`
+	Authors []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	NumberOfPages int `json:"number_of_pages"`
+}
+
+// searchResult is a page of the search API
+type searchResult struct {
+	Docs []struct {
+		Title         string   `json:"title"`
+		AuthorName    []string `json:"author_name"`
+		ISBN          []string `json:"isbn"`
+		NumberOfPages int      `json:"number_of_pages_median"`
+	} `json:"docs"`
+}
+
+// Client talks to Open Library or a compatible API
+type Client struct {
+	BaseURL string       // DefaultBaseURL when empty
+	HTTP    *http.Client // a client with a 30 second timeout when nil
+}
+
+// get fetches path with the query parameters and decodes the JSON response into v
+func (c *Client) get(path string, params url.Values, v any) error {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	err := httpjson.Get(httpjson.Request{HTTP: c.HTTP, BaseURL: baseURL, Path: path, Params: params}, v)
+	if errors.As(err, new(*httpjson.StatusError)) {
+		return fmt.Errorf("openlibrary %w", err)
+	}
+	return err
+}
+
+// Details fetches the title, authors and page count of the edition with an ISBN-13
+func (c *Client) Details(isbn int) (*base.BaseMedia, error) {
+	key := "ISBN:" + strconv.Itoa(isbn)
+	res := map[string]edition{}
+	if err := c.get("/api/books", url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}, &res); err != nil {
+		return nil, err
+	}
+	e, ok := res[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	item := book(isbn, e.Title, e.NumberOfPages)
+	for _, a := range e.Authors {
+		item.Authors = append(item.Authors, a.Name)
+	}
+	return &item, nil
+}
+
+// Search returns up to count books matching query, works without a valid ISBN are left out
+func (c *Client) Search(query string, count int) ([]base.BaseMedia, error) {
+	var res searchResult
+	params := url.Values{"q": {query}, "limit": {strconv.Itoa(count)}, "fields": {"title,author_name,isbn,number_of_pages_median"}}
+	if err := c.get("/search.json", params, &res); err != nil {
+		return nil, err
+	}
+
+	items := []base.BaseMedia{}
+	for _, doc := range res.Docs {
+		for _, raw := range doc.ISBN {
+			isbn, err := ParseISBN(raw)
+			if err != nil {
+				continue
+			}
+			item := book(isbn, doc.Title, doc.NumberOfPages)
+			item.Authors = doc.AuthorName
+			items = append(items, item)
+			break
+		}
+	}
+	return items, nil
+}
+
+// book returns a book item of the provider
+func book(isbn int, title string, pages int) base.BaseMedia {
+	if title == "" {
+		title = "Unknown Title"
+	}
+	return base.BaseMedia{
+		Provider:      Name,
+		ExternalID:    isbn,
+		Title:         title,
+		ProgressTotal: float64(pages),
+		ProgressUnit:  BookType.ProgressUnit,
+	}
+}
@@ -0,0 +1,81 @@
+package openlibrary
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve answers every request with status and body, it records the last query for the test
+func serve(t *testing.T, status int, body string, query *string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.Path + "?" + r.URL.RawQuery
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{BaseURL: srv.URL}
+}
+
+func TestDetails(t *testing.T) {
+	var query string
+	c := serve(t, 200, `{"ISBN:9780306406157":{"title":"Data Structures","authors":[{"name":"Ann Author"},{"name":"Bob Writer"}],"number_of_pages":412}}`, &query)
+
+	book, err := c.Details(9780306406157)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, "bibkeys=ISBN%3A9780306406157") || !strings.Contains(query, "jscmd=data") {
+		t.Errorf("query = %s", query)
+	}
+	if book.Title != "Data Structures" || book.ProgressTotal != 412 || book.ProgressUnit != "page" || strings.Join(book.Authors, ", ") != "Ann Author, Bob Writer" {
+		t.Errorf("book = %+v", book)
+	}
+
+	// the books API answers unknown ISBNs with an empty object
+	if _, err := c.Details(9781234567897); err != ErrNotFound {
+		t.Errorf("unknown ISBN error = %v, want ErrNotFound", err)
+	}
+
+	c = serve(t, http.StatusServiceUnavailable, ``, &query)
+	if _, err := c.Details(9780306406157); err == nil || err.Error() != "openlibrary responded with 503 Service Unavailable" {
+		t.Errorf("unavailable error = %v", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want int // external ID, 0 when the work is left out
+	}{
+		{"first valid ISBN", `{"title":"Data Structures","isbn":["not an isbn","0-306-40615-2","9781234567897"]}`, 9780306406157},
+		{"no ISBN", `{"title":"No ISBN"}`, 0},
+		{"only invalid ISBNs", `{"title":"Typos","isbn":["0306406153","123"]}`, 0},
+		{"ISBN-13", `{"title":"","isbn":["9781234567897"]}`, 9781234567897},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			c := serve(t, 200, `{"numFound":1,"docs":[`+tt.doc+`]}`, &query)
+			res, err := c.Search("structures", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(query, "/search.json?") || !strings.Contains(query, "limit=5") {
+				t.Errorf("query = %s", query)
+			}
+			if tt.want == 0 {
+				if len(res) != 0 {
+					t.Errorf("got %+v, want the work left out", res)
+				}
+				return
+			}
+			if len(res) != 1 || res[0].ExternalID != tt.want || res[0].Title == "" {
+				t.Errorf("got %+v, want ISBN %d", res, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package openlibrary
+
+import (
+	"everythingtracker/base"
+	"everythingtracker/provider"
+)
+
+// Provider serves book metadata from Open Library
+type Provider struct {
+	Client *Client
+}
+
+// Name implements provider.Provider
+func (Provider) Name() string {
+	return Name
+}
+
+// Lookup implements provider.Provider, externalID is an ISBN-13
+func (p Provider) Lookup(mediaType string, externalID int) (*base.BaseMedia, error) {
+	if mediaType != MediaTypeBook {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Details(externalID)
+}
+
+// Search implements provider.Provider
+func (p Provider) Search(mediaType string, query string, count int) ([]base.BaseMedia, error) {
+	if mediaType != MediaTypeBook {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Search(query, count)
+}
+
+// HasUserLists implements provider.Provider
+func (Provider) HasUserLists(mediaType string) bool {
+	return false
+}
+
+// FetchUserList implements provider.Provider
+// Open Library reading logs don't name editions, so there is nothing to sync, use POST /import/goodreads instead
+func (p Provider) FetchUserList(mediaType string, username, account string) ([]base.BaseMedia, error) {
+	if mediaType != MediaTypeBook {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return nil, provider.ErrNoUserLists
+}
@@ -0,0 +1,70 @@
+// Package provider declares the metadata provider abstraction and keeps a registry of providers
+package provider
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"everythingtracker/base"
+)
+
+var (
+	// ErrUnknownProvider is returned when no provider is registered under a name
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrUnsupportedMediaType is returned when a provider doesn't catalog a media type
+	ErrUnsupportedMediaType = errors.New("media type not supported by provider")
+	// ErrNoUserLists is returned by providers whose catalog has no user lists to sync from
+	ErrNoUserLists = errors.New("provider has no user lists")
+)
+
+// Provider looks up media metadata and user lists in an external catalog
+// Returned items carry the provider's name in Provider and its ID in ExternalID
+type Provider interface {
+	// Name is the identifier stored in the provider column and used in routes
+	Name() string
+	// Lookup fetches a single item by its ID at the provider
+	Lookup(mediaType string, externalID int) (*base.BaseMedia, error)
+	// Search returns up to count items matching query
+	Search(mediaType string, query string, count int) ([]base.BaseMedia, error)
+	// HasUserLists reports whether FetchUserList can fetch lists of mediaType
+	HasUserLists(mediaType string) bool
+	// FetchUserList returns every entry of the list of account at the provider
+	// username is the local user the list is fetched for, providers may use credentials they stored for them
+	FetchUserList(mediaType string, username, account string) ([]base.BaseMedia, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register makes a provider available under its name, replacing any previous one
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Get returns the provider registered under name
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names returns the names of all registered providers in sorted order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,109 @@
+package push
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterRoutes registers the outbox routes to the Gin router
+func RegisterRoutes(r *gin.Engine) {
+	api := r.Group("", auth.Middleware(), auth.RequireScope(auth.ScopeSyncRun))
+	api.GET("/outbox", GetOutboxHandler)
+	api.POST("/outbox/:id/retry", RetryHandler)
+}
+
+// GetOutboxHandler godoc
+// @Summary List queued pushes of a user
+// @Description Returns the local changes queued for AniList, newest first, with their state and the last error of failed attempts.
+// @Tags push
+// @Produce json
+// @Param username query string false "Owner of the entries, defaults to the caller"
+// @Param state query string false "Only entries in this state" Enums(pending, pushed, failed, cancelled)
+// @Success 200 {array} Entry
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /outbox [get]
+// GetOutboxHandler handles GET requests for the outbox
+func GetOutboxHandler(c *gin.Context) {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return
+	}
+
+	tx := db.DB.Where("username = ?", username)
+	if state := c.Query("state"); state != "" {
+		tx = tx.Where("state = ?", state)
+	}
+
+	entries := []Entry{}
+	if err := tx.Order("id DESC").Find(&entries).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, entries)
+}
+
+// RetryHandler godoc
+// @Summary Retry a failed push
+// @Description Queues a push that ran out of attempts again, it is sent on the next tick of the pusher.
+// @Tags push
+// @Produce json
+// @Param id path int true "Entry ID"
+// @Success 200 {object} Entry
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 409 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /outbox/{id}/retry [post]
+// RetryHandler handles retries of failed pushes
+func RetryHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	var entry Entry
+	err = db.DB.First(&entry, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "outbox entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := auth.Username(c, entry.Username); !ok {
+		return
+	}
+	if entry.State != StateFailed {
+		c.JSON(409, gin.H{"error": "only failed entries can be retried"})
+		return
+	}
+
+	var pending int64
+	db.DB.Model(&Entry{}).Where("username = ? AND media_type = ? AND media_id = ? AND state = ?",
+		entry.Username, entry.MediaType, entry.MediaID, StatePending).Count(&pending)
+	if pending > 0 {
+		c.JSON(409, gin.H{"error": "a newer change of this entry is already pending"})
+		return
+	}
+
+	err = db.DB.Model(&entry).Updates(map[string]any{"state": StatePending, "attempts": 0, "next_attempt_at": time.Now()}).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.DB.First(&entry, entry.ID)
+	c.JSON(200, entry)
+}
@@ -0,0 +1,346 @@
+// Package push sends local list changes back to AniList through an outbox table
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"everythingtracker/base"
+	"everythingtracker/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StatePushed    State = "pushed"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled" // a sync or conflict resolution took AniList's values before the push was sent
+)
+
+// Provider is the only provider local changes are pushed to
+const Provider = "anilist"
+
+// DefaultEndpoint is the AniList GraphQL API
+const DefaultEndpoint = "https://graphql.anilist.co"
+
+// MaxAttempts is the number of failed pushes after which an entry is given up
+const MaxAttempts = 8
+
+// tokenWait is how long an entry waits before looking for the user's token again
+const tokenWait = time.Hour
+
+// batchSize is the number of due entries pushed per tick
+const batchSize = 50
+
+// ErrNoToken is returned by a token lookup when the user hasn't connected their AniList account
+var ErrNoToken = errors.New("no AniList token for this user")
+
+// ErrRejected marks push errors that retrying can't fix, entries failing with it are given up right away
+var ErrRejected = errors.New("rejected by AniList")
+
+// Entry is a queued change of an AniList list entry
+type Entry struct {
+	ID            uint             `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	Username      string           `json:"username"`
+	MediaType     string           `json:"media_type"`
+	MediaID       int              `json:"media_id"` // AniList ID of the anime or manga
+	Status        base.MediaStatus `json:"status"`
+	Progress      float64          `json:"progress"`
+	Score         float64          `json:"score"` // 0-100
+	State         State            `gorm:"index" json:"state"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt time.Time        `gorm:"index" json:"next_attempt_at"`
+	LastError     string           `json:"last_error"`
+	PushedAt      *time.Time       `json:"pushed_at"`
+}
+
+// TableName sets the table name for outbox entries
+func (Entry) TableName() string {
+	return "push_outbox"
+}
+
+// Migrate creates the outbox table and the index allowing a single pending push per list entry
+func Migrate() error {
+	if err := db.DB.AutoMigrate(&Entry{}); err != nil {
+		return err
+	}
+	return db.DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_push_outbox_pending ON push_outbox(username, media_type, media_id) WHERE state = 'pending'").Error
+}
+
+// pendingEntry replaces the values of a pending push of the same list entry, so only the latest ones are sent
+var pendingEntry = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "username"}, {Name: "media_type"}, {Name: "media_id"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "state = 'pending'"}}},
+	DoUpdates:   clause.AssignmentColumns([]string{"status", "progress", "score", "updated_at"}),
+}
+
+// Enqueue queues the status, progress and score of an AniList item within tx if a local edit changed them
+func Enqueue(tx *gorm.DB, mediaType string, old, new base.BaseMedia) error {
+	if new.Provider != Provider {
+		return nil
+	}
+	if old.Status == new.Status && old.ProgressCurrent == new.ProgressCurrent && old.Score == new.Score {
+		return nil
+	}
+
+	entry := Entry{
+		Username:      new.Username,
+		MediaType:     mediaType,
+		MediaID:       new.ExternalID,
+		Status:        new.Status,
+		Progress:      new.ProgressCurrent,
+		Score:         new.Score,
+		State:         StatePending,
+		NextAttemptAt: time.Now(),
+	}
+	return tx.Clauses(pendingEntry).Create(&entry).Error
+}
+
+// Reconcile updates the pending pushes of items whose provider values a sync or conflict resolution just wrote within tx
+// A push is cancelled when the item now matches the provider's copy from its snapshot and refreshed with the item's values otherwise,
+// so a push queued earlier can't undo the values taken from AniList
+func Reconcile(tx *gorm.DB, username, mediaType string, items []base.BaseMedia) error {
+	if len(items) == 0 || items[0].Provider != Provider {
+		return nil
+	}
+
+	var pending []Entry
+	if err := tx.Where("username = ? AND media_type = ? AND state = ?", username, mediaType, StatePending).Find(&pending).Error; err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	byID := make(map[int]*base.BaseMedia, len(items))
+	for i := range items {
+		byID[items[i].ExternalID] = &items[i]
+	}
+
+	for _, e := range pending {
+		item, ok := byID[e.MediaID]
+		if !ok {
+			continue
+		}
+		updates := map[string]any{"status": item.Status, "progress": item.ProgressCurrent, "score": item.Score}
+		if item.SyncBase != nil {
+			remote := item.SyncBase.Media()
+			if remote.Status == item.Status && remote.ProgressCurrent == item.ProgressCurrent && remote.Score == item.Score {
+				updates = map[string]any{"state": StateCancelled}
+			}
+		}
+		if err := tx.Model(&e).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff returns the delay before the next push after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	d := 30 * time.Second << (attempts - 1)
+	if d > 6*time.Hour || d <= 0 {
+		return 6 * time.Hour
+	}
+	return d
+}
+
+// listStatus maps a local status to the AniList MediaListStatus enum
+func listStatus(status base.MediaStatus) (string, error) {
+	switch status {
+	case base.StatusPlanningWatch, base.StatusPlanningRead:
+		return "PLANNING", nil
+	case base.StatusWatching, base.StatusReading:
+		return "CURRENT", nil
+	case base.StatusCompleted:
+		return "COMPLETED", nil
+	case base.StatusDropped:
+		return "DROPPED", nil
+	case base.StatusPaused:
+		return "PAUSED", nil
+	case base.StatusRewatching, base.StatusRereading:
+		return "REPEATING", nil
+	}
+	return "", fmt.Errorf("%w: status %q has no AniList equivalent", ErrRejected, status)
+}
+
+const saveMutation = `mutation ($mediaId: Int, $status: MediaListStatus, $progress: Int, $scoreRaw: Int) {
+  SaveMediaListEntry(mediaId: $mediaId, status: $status, progress: $progress, scoreRaw: $scoreRaw) { id }
+}`
+
+// Pusher sends pending outbox entries to an AniList compatible GraphQL endpoint
+type Pusher struct {
+	Endpoint string       // DefaultEndpoint when empty
+	Client   *http.Client // http.DefaultClient when nil
+	// Token returns the OAuth token of a user or ErrNoToken, entries wait while it is nil
+	Token func(username string) (string, error)
+}
+
+// Save sends the values of an entry with the SaveMediaListEntry mutation
+func (p *Pusher) Save(ctx context.Context, token string, e Entry) error {
+	status, err := listStatus(e.Status)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"query": saveMutation,
+		"variables": map[string]any{
+			"mediaId":  e.MediaID,
+			"status":   status,
+			"progress": int(e.Progress),
+			"scoreRaw": int(math.Round(e.Score)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &res); err != nil || resp.StatusCode != http.StatusOK && len(res.Errors) == 0 {
+		return fmt.Errorf("anilist responded with %s", resp.Status)
+	}
+	if len(res.Errors) > 0 {
+		var msgs []string
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound {
+			// invalid values or an unknown media ID, sending them again won't help
+			return fmt.Errorf("%w: %s", ErrRejected, strings.Join(msgs, "; "))
+		}
+		return errors.New("anilist: " + strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// Start pushes due entries every tick until ctx is cancelled
+// The returned channel is closed once the pusher has stopped
+func (p *Pusher) Start(ctx context.Context, tick time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		for {
+			p.pushDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// pushDue pushes the pending entries whose next attempt time has passed, oldest first
+func (p *Pusher) pushDue(ctx context.Context) {
+	var due []Entry
+	err := db.DB.Where("state = ? AND next_attempt_at <= ?", StatePending, time.Now()).
+		Order("id").Limit(batchSize).Find(&due).Error
+	if err != nil {
+		log.Println("push: failed to load due entries:", err)
+		return
+	}
+
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		p.push(ctx, &due[i])
+	}
+}
+
+// push sends a single entry and records the outcome
+func (p *Pusher) push(ctx context.Context, e *Entry) {
+	token, err := "", ErrNoToken
+	if p.Token != nil {
+		token, err = p.Token(e.Username)
+	}
+	if errors.Is(err, ErrNoToken) {
+		// waiting for the user to connect their account doesn't use up attempts
+		update(e, map[string]any{"last_error": err.Error(), "next_attempt_at": time.Now().Add(tokenWait)})
+		return
+	}
+	if err == nil {
+		err = p.Save(ctx, token, *e)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	if err == nil {
+		// a newer edit queued during the push stays pending
+		res := db.DB.Model(&Entry{}).
+			Where("id = ? AND status = ? AND progress = ? AND score = ?", e.ID, e.Status, e.Progress, e.Score).
+			Updates(map[string]any{"state": StatePushed, "pushed_at": now, "last_error": ""})
+		if res.Error != nil {
+			log.Println("push: failed to mark entry", e.ID, "as pushed:", res.Error)
+		}
+		return
+	}
+
+	attempts := e.Attempts + 1
+	updates := map[string]any{"attempts": attempts, "last_error": err.Error(), "next_attempt_at": now.Add(backoff(attempts))}
+	if attempts >= MaxAttempts || errors.Is(err, ErrRejected) {
+		updates["state"] = StateFailed
+	}
+	log.Println("push: entry", e.ID, "failed:", err)
+	update(e, updates)
+}
+
+// update stores the outcome of a push attempt
+func update(e *Entry, updates map[string]any) {
+	if err := db.DB.Model(e).Updates(updates).Error; err != nil {
+		log.Println("push: failed to update entry", e.ID, err)
+	}
+}
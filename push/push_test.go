@@ -0,0 +1,194 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"everythingtracker/base"
+	"everythingtracker/db"
+)
+
+// fakeAniList is a GraphQL server answering every request with status and body and recording the last request
+type fakeAniList struct {
+	status int
+	body   string
+	auth   string
+	vars   map[string]any
+}
+
+func (f *fakeAniList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Variables map[string]any `json:"variables"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &req)
+	f.auth, f.vars = r.Header.Get("Authorization"), req.Variables
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.status)
+	io.WriteString(w, f.body)
+}
+
+// newPusher starts a fake server answering with status and body and returns a pusher sending to it
+func newPusher(t *testing.T, status int, body string) (*Pusher, *fakeAniList) {
+	t.Helper()
+	fake := &fakeAniList{status: status, body: body}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return &Pusher{Endpoint: srv.URL, Token: func(string) (string, error) { return "secret", nil }}, fake
+}
+
+// openTestDB points db.DB at a fresh database with the outbox table
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db.InitDatabase(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queue stores a pending entry with the given status
+func queue(t *testing.T, status base.MediaStatus) *Entry {
+	t.Helper()
+	e := &Entry{Username: "alice", MediaType: "anime", MediaID: 21, Status: status, Progress: 7, Score: 85, State: StatePending, NextAttemptAt: time.Now()}
+	if err := db.DB.Create(e).Error; err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// reload reads an entry back from the outbox
+func reload(t *testing.T, e *Entry) Entry {
+	t.Helper()
+	var res Entry
+	if err := db.DB.First(&res, e.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSave(t *testing.T) {
+	p, fake := newPusher(t, 200, `{"data":{"SaveMediaListEntry":{"id":1}}}`)
+	e := Entry{MediaID: 21, Status: base.StatusRewatching, Progress: 7, Score: 84.6}
+
+	if err := p.Save(context.Background(), "secret", e); err != nil {
+		t.Fatal(err)
+	}
+	if fake.auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", fake.auth)
+	}
+	want := map[string]any{"mediaId": 21.0, "status": "REPEATING", "progress": 7.0, "scoreRaw": 85.0}
+	for k, v := range want {
+		if fake.vars[k] != v {
+			t.Errorf("variable %s = %v, want %v", k, fake.vars[k], v)
+		}
+	}
+}
+
+func TestSaveErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		entry    Entry
+		rejected bool
+	}{
+		{"graphql error", 200, `{"errors":[{"message":"Internal"}]}`, Entry{Status: base.StatusWatching}, false},
+		{"server error", 502, `bad gateway`, Entry{Status: base.StatusWatching}, false},
+		{"invalid values", 400, `{"errors":[{"message":"Validation error"}]}`, Entry{Status: base.StatusWatching}, true},
+		{"unknown media", 404, `{"errors":[{"message":"Not Found."}]}`, Entry{Status: base.StatusWatching}, true},
+		{"empty status", 200, `{}`, Entry{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newPusher(t, tt.status, tt.body)
+			err := p.Save(context.Background(), "secret", tt.entry)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrRejected) != tt.rejected {
+				t.Errorf("error %q rejected = %v, want %v", err, !tt.rejected, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestPushMarksPushed(t *testing.T) {
+	openTestDB(t)
+	p, _ := newPusher(t, 200, `{"data":{"SaveMediaListEntry":{"id":1}}}`)
+	e := queue(t, base.StatusWatching)
+
+	p.pushDue(context.Background())
+
+	got := reload(t, e)
+	if got.State != StatePushed || got.PushedAt == nil || got.LastError != "" {
+		t.Errorf("entry = %+v, want pushed", got)
+	}
+}
+
+func TestPushBacksOff(t *testing.T) {
+	openTestDB(t)
+	p, _ := newPusher(t, 500, `{"errors":[{"message":"Internal"}]}`)
+	e := queue(t, base.StatusWatching)
+
+	before := time.Now()
+	p.pushDue(context.Background())
+
+	got := reload(t, e)
+	if got.State != StatePending || got.Attempts != 1 || got.LastError == "" {
+		t.Errorf("entry = %+v, want pending after one failed attempt", got)
+	}
+	if got.NextAttemptAt.Before(before.Add(backoff(1))) {
+		t.Errorf("next attempt at %v, want at least %v later", got.NextAttemptAt, backoff(1))
+	}
+
+	// the last allowed attempt gives up
+	db.DB.Model(e).Updates(map[string]any{"attempts": MaxAttempts - 1, "next_attempt_at": time.Now()})
+	p.pushDue(context.Background())
+	if got := reload(t, e); got.State != StateFailed || got.Attempts != MaxAttempts {
+		t.Errorf("entry = %+v, want failed after %d attempts", got, MaxAttempts)
+	}
+}
+
+func TestPushFailsRejected(t *testing.T) {
+	openTestDB(t)
+	p, _ := newPusher(t, 200, `{"data":{"SaveMediaListEntry":{"id":1}}}`)
+	e := queue(t, "")
+
+	p.pushDue(context.Background())
+
+	if got := reload(t, e); got.State != StateFailed || got.Attempts != 1 {
+		t.Errorf("entry = %+v, want failed right away", got)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	openTestDB(t)
+	e := queue(t, base.StatusWatching)
+
+	// a sync keeping the local progress refreshes the push with the item's values
+	item := base.BaseMedia{Username: "alice", Provider: Provider, ExternalID: 21, Status: base.StatusWatching, ProgressCurrent: 8, Score: 85}
+	item.SyncBase = base.NewSyncSnapshot(base.BaseMedia{Status: base.StatusWatching, ProgressCurrent: 6, Score: 85})
+	if err := Reconcile(db.DB, "alice", "anime", []base.BaseMedia{item}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, e); got.State != StatePending || got.Progress != 8 {
+		t.Errorf("entry = %+v, want pending with progress 8", got)
+	}
+
+	// taking the provider's values cancels it
+	item.ProgressCurrent = 6
+	if err := Reconcile(db.DB, "alice", "anime", []base.BaseMedia{item}); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, e); got.State != StateCancelled {
+		t.Errorf("entry = %+v, want cancelled", got)
+	}
+}
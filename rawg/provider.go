@@ -0,0 +1,45 @@
+package rawg
+
+import (
+	"everythingtracker/base"
+	"everythingtracker/provider"
+)
+
+// Provider serves game metadata and user libraries from RAWG
+type Provider struct {
+	Client *Client
+}
+
+// Name implements provider.Provider
+func (Provider) Name() string {
+	return Name
+}
+
+// Lookup implements provider.Provider
+func (p Provider) Lookup(mediaType string, externalID int) (*base.BaseMedia, error) {
+	if mediaType != MediaTypeGame {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Details(externalID)
+}
+
+// Search implements provider.Provider
+func (p Provider) Search(mediaType string, query string, count int) ([]base.BaseMedia, error) {
+	if mediaType != MediaTypeGame {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Search(query, count)
+}
+
+// HasUserLists implements provider.Provider
+func (Provider) HasUserLists(mediaType string) bool {
+	return mediaType == MediaTypeGame
+}
+
+// FetchUserList implements provider.Provider, account is the RAWG user name
+func (p Provider) FetchUserList(mediaType string, username, account string) ([]base.BaseMedia, error) {
+	if mediaType != MediaTypeGame {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.UserList(account)
+}
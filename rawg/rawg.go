@@ -0,0 +1,180 @@
+// Package rawg tracks video games, entered by hand or with metadata and user libraries from RAWG or a compatible API
+package rawg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"everythingtracker/base"
+	"everythingtracker/internal/httpjson"
+)
+
+// Name is the provider name of RAWG
+const Name = "rawg"
+
+// DefaultBaseURL is the RAWG API
+const DefaultBaseURL = "https://api.rawg.io/api"
+
+// MediaTypeGame is the media type name used in routes and the progress history
+const MediaTypeGame = "game"
+
+// GameType is the media type of video games, registered by RegisterMediaTypes
+// Games are tracked in hours played or percent completion, and entered by hand unless a RAWG ID is given
+// Reaching the hours total beats a game, only reaching 100 percent completes it fully
+var GameType = base.MediaType{
+	Name:         MediaTypeGame,
+	Table:        "games",
+	ProgressUnit: "hours",
+	Units:        []string{base.PercentUnit},
+	Statuses:     []base.MediaStatus{base.StatusBacklog, base.StatusPlaying, base.StatusBeaten, base.StatusFullyCompleted, base.StatusShelved},
+	Active:       base.StatusPlaying,
+	Finished:     base.StatusBeaten,
+	Complete:     base.StatusFullyCompleted,
+	Providers:    []string{base.ManualProvider, Name},
+}
+
+// RegisterMediaTypes registers games
+func RegisterMediaTypes() {
+	base.RegisterMediaType(GameType)
+}
+
+// maxPages bounds the pages fetched of a single user library
+const maxPages = 100
+
+// game is a game as returned by the details, search and user library endpoints
+type game struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	UserGame *struct {
+		Status string `json:"status"`
+	} `json:"user_game"` // only in user libraries
+}
+
+// page is a page of search or user library results
+type page struct {
+	Next    *string `json:"next"`
+	Results []game  `json:"results"`
+}
+
+// item converts a RAWG game to a media item
+// RAWG only knows average playtimes, so the total is left for the user to set
+func (g game) item() base.BaseMedia {
+	title := g.Name
+	if title == "" {
+		title = "Unknown Title"
+	}
+	return base.BaseMedia{Provider: Name, ExternalID: g.ID, Title: title, ProgressUnit: GameType.ProgressUnit}
+}
+
+// MapStatus maps the status of a game in a RAWG library to internal MediaStatus
+func MapStatus(status string) (base.MediaStatus, error) {
+	switch status {
+	case "toplay", "owned", "yet":
+		return base.StatusBacklog, nil
+	case "playing":
+		return base.StatusPlaying, nil
+	case "beaten":
+		return base.StatusBeaten, nil
+	case "dropped":
+		return base.StatusShelved, nil
+	}
+	return "", fmt.Errorf("unknown RAWG status %q", status)
+}
+
+// Client talks to RAWG or a compatible API
+type Client struct {
+	BaseURL string       // DefaultBaseURL when empty
+	Key     string       // API key, sent as the key query parameter
+	HTTP    *http.Client // a client with a 30 second timeout when nil
+}
+
+// get fetches path with the query parameters and the API key and decodes the JSON response into v
+func (c *Client) get(path string, params url.Values, v any) error {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	if c.Key != "" {
+		params.Set("key", c.Key)
+	}
+	err := httpjson.Get(httpjson.Request{HTTP: c.HTTP, BaseURL: baseURL, Path: path, Params: params}, v)
+	return apiError(err)
+}
+
+// apiError prefixes errors with the provider, using RAWG's detail or error message when the response has one
+func apiError(err error) error {
+	var se *httpjson.StatusError
+	if !errors.As(err, &se) {
+		return err
+	}
+	var res struct {
+		Detail string `json:"detail"`
+		Error  string `json:"error"`
+	}
+	if json.Unmarshal(se.Body, &res) == nil && res.Detail+res.Error != "" {
+		return errors.New("rawg: " + res.Detail + res.Error)
+	}
+	return fmt.Errorf("rawg %w", err)
+}
+
+// Details fetches a game by its RAWG ID
+func (c *Client) Details(id int) (*base.BaseMedia, error) {
+	var g game
+	if err := c.get("/games/"+strconv.Itoa(id), nil, &g); err != nil {
+		return nil, err
+	}
+	item := g.item()
+	return &item, nil
+}
+
+// Search returns up to count games matching query
+func (c *Client) Search(query string, count int) ([]base.BaseMedia, error) {
+	var p page
+	if err := c.get("/games", url.Values{"search": {query}, "page_size": {strconv.Itoa(count)}}, &p); err != nil {
+		return nil, err
+	}
+
+	items := []base.BaseMedia{}
+	for _, g := range p.Results {
+		if len(items) == count {
+			break
+		}
+		items = append(items, g.item())
+	}
+	return items, nil
+}
+
+// UserList fetches every game in the library of a RAWG user with its status
+// Games with a status RAWG added later than this client are skipped
+func (c *Client) UserList(username string) ([]base.BaseMedia, error) {
+	var items []base.BaseMedia
+	for n := 1; n <= maxPages; n++ {
+		var p page
+		if err := c.get("/users/"+url.PathEscape(username)+"/games", url.Values{"page": {strconv.Itoa(n)}}, &p); err != nil {
+			return nil, err
+		}
+		for _, g := range p.Results {
+			if g.UserGame == nil {
+				continue
+			}
+			status, err := MapStatus(g.UserGame.Status)
+			if err != nil {
+				continue
+			}
+			item := g.item()
+			item.Status = status
+			items = append(items, item)
+		}
+		if p.Next == nil || len(p.Results) == 0 {
+			break
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,122 @@
+package rawg
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"everythingtracker/base"
+	"everythingtracker/internal/httpjson"
+)
+
+func TestSetProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		unit   string
+		total  float64
+		status base.MediaStatus
+		value  float64
+		want   base.MediaStatus
+	}{
+		{"hours total beats", "hours", 40, base.StatusPlaying, 40, base.StatusBeaten},
+		{"percent completes", base.PercentUnit, 100, base.StatusPlaying, 100, base.StatusFullyCompleted},
+		{"hours total keeps a full completion", "hours", 40, base.StatusFullyCompleted, 45, base.StatusFullyCompleted},
+		{"percent below 100 keeps beaten", base.PercentUnit, 100, base.StatusBeaten, 80, base.StatusBeaten},
+		{"percent falling restarts", base.PercentUnit, 100, base.StatusFullyCompleted, 90, base.StatusPlaying},
+		{"progress starts a backlog game", "hours", 40, base.StatusBacklog, 2, base.StatusPlaying},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := base.BaseMedia{ProgressUnit: tt.unit, ProgressTotal: tt.total, Status: tt.status}
+			g.SetProgress(tt.value, GameType)
+			if g.Status != tt.want {
+				t.Errorf("status = %q, want %q", g.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   base.MediaStatus
+	}{
+		{"toplay", base.StatusBacklog},
+		{"owned", base.StatusBacklog},
+		{"yet", base.StatusBacklog},
+		{"playing", base.StatusPlaying},
+		{"beaten", base.StatusBeaten},
+		{"dropped", base.StatusShelved},
+	}
+	for _, tt := range tests {
+		got, err := MapStatus(tt.status)
+		if err != nil || got != tt.want {
+			t.Errorf("MapStatus(%q) = %q, %v, want %q", tt.status, got, err, tt.want)
+		}
+	}
+
+	if _, err := MapStatus("wishlist"); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+}
+
+// TestUserList checks that the library is paged with the API key and that games RAWG gives no known status are skipped
+func TestUserList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path != "/users/alice/games" || q.Get("key") != "secret":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"detail":"Not found."}`))
+		case q.Get("page") == "1":
+			w.Write([]byte(`{"next":"page 2","results":[
+				{"id":3498,"name":"Grand Theft Auto V","user_game":{"status":"beaten"}},
+				{"id":4200,"name":"Portal 2"}]}`))
+		default:
+			w.Write([]byte(`{"next":null,"results":[
+				{"id":5286,"name":"Tomb Raider","user_game":{"status":"toplay"}},
+				{"id":13536,"name":"Portal","user_game":{"status":"wishlist"}}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c := &Client{BaseURL: srv.URL, Key: "secret"}
+
+	res, err := c.UserList("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].ExternalID != 3498 || res[0].Status != base.StatusBeaten || res[1].ExternalID != 5286 || res[1].Status != base.StatusBacklog {
+		t.Errorf("games = %+v", res)
+	}
+	// the total is left for the user, only the hours total beats a game
+	if res[0].ProgressTotal != 0 || res[0].ProgressUnit != "hours" {
+		t.Errorf("game = %+v", res[0])
+	}
+
+	if _, err := c.UserList("nobody"); err == nil || err.Error() != "rawg: Not found." {
+		t.Errorf("unknown user error = %v", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"detail":"Not found."}`, "rawg: Not found."},
+		{`{"error":"The key parameter is not provided"}`, "rawg: The key parameter is not provided"},
+		{`<html>`, "rawg responded with 401 Unauthorized"},
+	}
+	for _, tt := range tests {
+		err := apiError(&httpjson.StatusError{Status: "401 Unauthorized", Body: []byte(tt.body)})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("apiError(%s) = %v, want %q", tt.body, err, tt.want)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if err := apiError(other); err != other {
+		t.Errorf("apiError of a transport error = %v", err)
+	}
+}
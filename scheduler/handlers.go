@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"everythingtracker/auth"
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/provider"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScheduleRequest registers or updates automatic sync for a user
+type ScheduleRequest struct {
+	Username        string   `json:"username"`
+	Provider        string   `json:"provider"`
+	Anime           bool     `json:"anime"`
+	Manga           bool     `json:"manga"`
+	MediaTypes      []string `json:"media_types"`
+	IntervalMinutes int      `json:"interval_minutes"`
+}
+
+// RegisterRoutes registers the sync schedule routes to the Gin router
+func RegisterRoutes(r *gin.Engine) {
+	api := r.Group("", auth.Middleware(), auth.RequireScope(auth.ScopeSyncRun))
+	api.GET("/schedules", GetScheduleHandler)
+	api.PUT("/schedules", PutScheduleHandler)
+	api.DELETE("/schedules", DeleteScheduleHandler)
+}
+
+// findSchedule loads the schedule addressed by the username and provider query parameters
+// It writes an error response and returns false when it can't be found
+func findSchedule(c *gin.Context, s *Schedule) bool {
+	username, ok := auth.Username(c, c.Query("username"))
+	if !ok {
+		return false
+	}
+	providerName := c.DefaultQuery("provider", base.DefaultProvider)
+
+	err := db.DB.Where("username = ? AND provider = ?", username, providerName).First(s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "no sync schedule for this user"})
+		return false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// GetScheduleHandler godoc
+// @Summary Get a user's sync schedule
+// @Description Returns the automatic sync settings of a user together with the time and outcome of the last run.
+// @Tags schedules
+// @Produce json
+// @Param username query string false "Username of the schedule, defaults to the caller"
+// @Param provider query string false "Provider synced from" default(anilist)
+// @Success 200 {object} Schedule
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /schedules [get]
+// GetScheduleHandler handles GET requests for sync schedules
+func GetScheduleHandler(c *gin.Context) {
+	var s Schedule
+	if !findSchedule(c, &s) {
+		return
+	}
+	c.JSON(200, s)
+}
+
+// PutScheduleHandler godoc
+// @Summary Register a user for automatic sync
+// @Description Creates or updates the automatic sync schedule of a user. The first run happens on the next scheduler tick.
+// @Description Anime and manga are enabled by their flags, other media types of the provider such as movie and tv are listed in media_types.
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param schedule body ScheduleRequest true "Schedule settings"
+// @Success 200 {object} Schedule
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /schedules [put]
+// PutScheduleHandler handles registration for automatic sync
+func PutScheduleHandler(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	username, ok := auth.Username(c, req.Username)
+	if !ok {
+		return
+	}
+
+	s := Schedule{
+		Username:        username,
+		Provider:        req.Provider,
+		Anime:           req.Anime,
+		Manga:           req.Manga,
+		MediaTypes:      req.MediaTypes,
+		IntervalMinutes: req.IntervalMinutes,
+		NextRunAt:       time.Now(),
+	}
+	if s.Provider == "" {
+		s.Provider = base.DefaultProvider
+	}
+	p, err := provider.Get(s.Provider)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error() + ": " + s.Provider})
+		return
+	}
+	if err := s.validate(p); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}, {Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"anime", "manga", "media_types", "interval_minutes", "next_run_at", "updated_at"}),
+	}).Create(&s).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.DB.Where("username = ? AND provider = ?", s.Username, s.Provider).First(&s)
+	c.JSON(200, s)
+}
+
+// DeleteScheduleHandler godoc
+// @Summary Unregister a user from automatic sync
+// @Description Removes the automatic sync schedule of a user.
+// @Tags schedules
+// @Param username query string false "Username of the schedule, defaults to the caller"
+// @Param provider query string false "Provider synced from" default(anilist)
+// @Success 204
+// @Failure 400 {object} anilist.ErrorResponse
+// @Failure 404 {object} anilist.ErrorResponse
+// @Failure 500 {object} anilist.ErrorResponse
+// @Security BearerAuth
+// @Router /schedules [delete]
+// DeleteScheduleHandler handles removal of sync schedules
+func DeleteScheduleHandler(c *gin.Context) {
+	var s Schedule
+	if !findSchedule(c, &s) {
+		return
+	}
+	if err := db.DB.Delete(&s).Error; err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(204)
+}
@@ -0,0 +1,207 @@
+// Package scheduler runs periodic provider syncs for users who registered for them
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"everythingtracker/anilist"
+	"everythingtracker/base"
+	"everythingtracker/db"
+	"everythingtracker/jobs"
+	"everythingtracker/provider"
+)
+
+// MinInterval is the shortest allowed time between two syncs of the same user
+const MinInterval = 15 * time.Minute
+
+// Schedule registers a user for automatic sync from a provider
+type Schedule struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Username        string     `gorm:"uniqueIndex:idx_sync_schedules_user_provider" json:"username"`
+	Provider        string     `gorm:"uniqueIndex:idx_sync_schedules_user_provider;default:anilist" json:"provider"`
+	Anime           bool       `json:"anime"`
+	Manga           bool       `json:"manga"`
+	MediaTypes      []string   `gorm:"serializer:json" json:"media_types"` // other media types of the provider, such as movie or tv
+	IntervalMinutes int        `json:"interval_minutes"`
+	NextRunAt       time.Time  `gorm:"index" json:"next_run_at"`
+	LastRunAt       *time.Time `json:"last_run_at"`
+	LastStatus      string     `json:"last_status"` // running, ok or error, empty before the first run
+	LastError       string     `json:"last_error"`
+	LastCount       int        `json:"last_count"`                          // entries fetched by the last run
+	PendingJobs     []uint     `gorm:"serializer:json" json:"pending_jobs"` // sync jobs of the running run
+}
+
+// Interval returns the configured interval as a duration
+func (s Schedule) Interval() time.Duration {
+	return time.Duration(s.IntervalMinutes) * time.Minute
+}
+
+// mediaTypes returns the media types enabled for the schedule
+func (s Schedule) mediaTypes() []string {
+	var types []string
+	if s.Anime {
+		types = append(types, anilist.MediaTypeAnime)
+	}
+	if s.Manga {
+		types = append(types, anilist.MediaTypeManga)
+	}
+	return append(types, s.MediaTypes...)
+}
+
+// jitter spreads runs of schedules sharing an interval by up to a tenth of it
+func jitter(interval time.Duration) time.Duration {
+	return rand.N(interval/10 + 1)
+}
+
+// Start checks for due schedules every tick until ctx is cancelled
+// The returned channel is closed once the scheduler has stopped
+func Start(ctx context.Context, tick time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+
+		for {
+			runDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+// runDue records the outcome of runs whose jobs have finished and starts every schedule whose next run time has passed
+func runDue(ctx context.Context) {
+	var running []Schedule
+	if err := db.DB.Where("last_status = ?", "running").Find(&running).Error; err != nil {
+		log.Println("scheduler: failed to load running schedules:", err)
+		return
+	}
+	for i := range running {
+		collect(&running[i])
+	}
+
+	var due []Schedule
+	err := db.DB.Where("next_run_at <= ? AND last_status <> ?", time.Now(), "running").Order("next_run_at").Find(&due).Error
+	if err != nil {
+		log.Println("scheduler: failed to load due schedules:", err)
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		run(&due[i])
+	}
+}
+
+// run queues a sync job for every enabled media type of a schedule, a later tick records their outcome
+func run(s *Schedule) {
+	now := time.Now()
+	var errs []string
+	s.PendingJobs = nil
+
+	for _, mediaType := range s.mediaTypes() {
+		job, err := jobs.Enqueue(s.Username, s.Provider, mediaType, anilist.SyncOptions{Prune: true})
+		if err != nil && !errors.Is(err, jobs.ErrActive) {
+			errs = append(errs, mediaType+": "+err.Error())
+			continue
+		}
+		s.PendingJobs = append(s.PendingJobs, job.ID)
+	}
+
+	s.LastRunAt = &now
+	s.LastCount = 0
+	s.LastStatus, s.LastError = "running", strings.Join(errs, "; ")
+	s.NextRunAt = now.Add(s.Interval() + jitter(s.Interval()))
+	if len(s.PendingJobs) == 0 {
+		finish(s, errs)
+		return
+	}
+	save(s)
+}
+
+// collect records the outcome of a running schedule once all of its jobs are done
+func collect(s *Schedule) {
+	var errs []string
+	if s.LastError != "" {
+		errs = append(errs, s.LastError)
+	}
+
+	count := 0
+	for _, id := range s.PendingJobs {
+		job, err := jobs.Get(id)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !job.Done() {
+			return
+		}
+		count += job.Processed
+		if job.State == jobs.StateFailed {
+			errs = append(errs, job.MediaType+": "+job.Error)
+		}
+	}
+
+	s.LastCount = count
+	finish(s, errs)
+}
+
+// finish stores the outcome of a run
+func finish(s *Schedule, errs []string) {
+	s.PendingJobs = nil
+	s.LastStatus, s.LastError = "ok", ""
+	if len(errs) > 0 {
+		s.LastStatus, s.LastError = "error", strings.Join(errs, "; ")
+		log.Println("scheduler: sync failed for", s.Username+":", s.LastError)
+	}
+	save(s)
+}
+
+// save writes the run fields of a schedule
+func save(s *Schedule) {
+	err := db.DB.Model(s).Select("last_run_at", "last_count", "last_status", "last_error", "next_run_at", "pending_jobs").Updates(s).Error
+	if err != nil {
+		log.Println("scheduler: failed to save schedule:", err)
+	}
+}
+
+// validate checks a schedule of provider p before it is stored
+func (s Schedule) validate(p provider.Provider) error {
+	if s.Username == "" {
+		return errors.New("username is required")
+	}
+	if !s.Anime && !s.Manga && len(s.MediaTypes) == 0 {
+		return errors.New("at least one of anime, manga or media_types must be enabled")
+	}
+	for _, name := range s.mediaTypes() {
+		t, ok := base.LookupMediaType(name)
+		if !ok {
+			return errors.New("unknown media type: " + name)
+		}
+		if !t.Supports(s.Provider) {
+			return errors.New(s.Provider + " doesn't catalog " + name)
+		}
+		if !p.HasUserLists(name) {
+			return errors.New(s.Provider + " has no " + name + " lists to sync")
+		}
+	}
+	if s.Interval() < MinInterval {
+		return errors.New("interval_minutes must be at least " + MinInterval.String())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package tmdb
+
+import (
+	"everythingtracker/base"
+	"everythingtracker/provider"
+)
+
+// Provider serves movie and series metadata and user lists from TMDB
+type Provider struct {
+	Client *Client
+}
+
+// supports reports whether TMDB catalogs mediaType
+func supports(mediaType string) bool {
+	return mediaType == MediaTypeMovie || mediaType == MediaTypeTV
+}
+
+// Name implements provider.Provider
+func (Provider) Name() string {
+	return Name
+}
+
+// Lookup implements provider.Provider
+func (p Provider) Lookup(mediaType string, externalID int) (*base.BaseMedia, error) {
+	if !supports(mediaType) {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Details(mediaType, externalID)
+}
+
+// Search implements provider.Provider
+func (p Provider) Search(mediaType string, query string, count int) ([]base.BaseMedia, error) {
+	if !supports(mediaType) {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.Search(mediaType, query, count)
+}
+
+// HasUserLists implements provider.Provider
+func (Provider) HasUserLists(mediaType string) bool {
+	return supports(mediaType)
+}
+
+// FetchUserList implements provider.Provider, account is the TMDB account ID
+func (p Provider) FetchUserList(mediaType string, username, account string) ([]base.BaseMedia, error) {
+	if !supports(mediaType) {
+		return nil, provider.ErrUnsupportedMediaType
+	}
+	return p.Client.UserList(mediaType, account)
+}
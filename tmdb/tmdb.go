@@ -0,0 +1,227 @@
+// Package tmdb tracks movies and TV series with metadata and user lists from TMDB or a compatible API
+package tmdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"everythingtracker/base"
+	"everythingtracker/internal/httpjson"
+)
+
+// Name is the provider name of TMDB
+const Name = "tmdb"
+
+// DefaultBaseURL is the TMDB v3 API
+const DefaultBaseURL = "https://api.themoviedb.org/3"
+
+// Media type names used in routes and the progress history
+const (
+	MediaTypeMovie = "movie"
+	MediaTypeTV    = "tv"
+)
+
+// MovieType and TVType are the media types cataloged by TMDB, they are registered by RegisterMediaTypes
+// Movies are tracked in minutes watched or percent, series in episodes across all seasons
+var (
+	MovieType = base.MediaType{
+		Name:         MediaTypeMovie,
+		Table:        "movies",
+		ProgressUnit: "min",
+		Units:        []string{base.PercentUnit},
+		Statuses:     []base.MediaStatus{base.StatusPlanningWatch, base.StatusWatching, base.StatusCompleted, base.StatusDropped, base.StatusPaused, base.StatusRewatching},
+		Active:       base.StatusWatching,
+		Repeating:    base.StatusRewatching,
+		Providers:    []string{Name},
+	}
+	TVType = base.MediaType{
+		Name:         MediaTypeTV,
+		Table:        "tv_series",
+		ProgressUnit: "ep",
+		Statuses:     []base.MediaStatus{base.StatusPlanningWatch, base.StatusWatching, base.StatusCompleted, base.StatusDropped, base.StatusPaused, base.StatusRewatching},
+		Active:       base.StatusWatching,
+		Repeating:    base.StatusRewatching,
+		Providers:    []string{Name},
+	}
+)
+
+// RegisterMediaTypes registers movies and TV series
+func RegisterMediaTypes() {
+	base.RegisterMediaType(MovieType)
+	base.RegisterMediaType(TVType)
+}
+
+// maxPages bounds the pages fetched of a single user list
+const maxPages = 100
+
+// media is a movie or series as returned by the details, search and account endpoints
+// Movies carry title and runtime, series name, episode count and seasons
+type media struct {
+	ID               int    `json:"id"`
+	Title            string `json:"title"`
+	Name             string `json:"name"`
+	Runtime          int    `json:"runtime"` // minutes
+	NumberOfEpisodes int    `json:"number_of_episodes"`
+	Seasons          []struct {
+		SeasonNumber int `json:"season_number"`
+		EpisodeCount int `json:"episode_count"`
+	} `json:"seasons"`
+	Rating float64 `json:"rating"` // 0.5-10, only on rated lists
+}
+
+// page is a page of search or account list results
+type page struct {
+	Page       int     `json:"page"`
+	TotalPages int     `json:"total_pages"`
+	Results    []media `json:"results"`
+}
+
+// item converts a TMDB movie or series to a media item of mediaType
+func (m media) item(mediaType string) base.BaseMedia {
+	item := base.BaseMedia{Provider: Name, ExternalID: m.ID, Title: m.Title}
+	if mediaType == MediaTypeTV {
+		item.Title = m.Name
+		item.ProgressUnit = TVType.ProgressUnit
+		item.ProgressTotal = float64(m.NumberOfEpisodes)
+		// season 0 holds specials, which don't count towards the episodes of the series
+		for _, s := range m.Seasons {
+			if s.SeasonNumber > 0 {
+				item.Seasons = append(item.Seasons, s.EpisodeCount)
+			}
+		}
+	} else {
+		item.ProgressUnit = MovieType.ProgressUnit
+		item.ProgressTotal = float64(m.Runtime)
+	}
+	if item.Title == "" {
+		item.Title = "Unknown Title"
+	}
+	return item
+}
+
+// Client talks to TMDB or a compatible API
+type Client struct {
+	BaseURL string       // DefaultBaseURL when empty
+	Token   string       // API read access token, sent as a bearer token
+	HTTP    *http.Client // a client with a 30 second timeout when nil
+}
+
+// get fetches path with the query parameters and decodes the JSON response into v
+func (c *Client) get(path string, params url.Values, v any) error {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	err := httpjson.Get(httpjson.Request{HTTP: c.HTTP, BaseURL: baseURL, Path: path, Params: params, Token: c.Token}, v)
+	return apiError(err)
+}
+
+// apiError prefixes errors with the provider, using TMDB's status message when the response has one
+func apiError(err error) error {
+	var se *httpjson.StatusError
+	if !errors.As(err, &se) {
+		return err
+	}
+	var res struct {
+		StatusMessage string `json:"status_message"`
+	}
+	if json.Unmarshal(se.Body, &res) == nil && res.StatusMessage != "" {
+		return errors.New("tmdb: " + res.StatusMessage)
+	}
+	return fmt.Errorf("tmdb %w", err)
+}
+
+// Details fetches a movie or series by its TMDB ID
+func (c *Client) Details(mediaType string, id int) (*base.BaseMedia, error) {
+	var m media
+	if err := c.get("/"+mediaType+"/"+strconv.Itoa(id), nil, &m); err != nil {
+		return nil, err
+	}
+	item := m.item(mediaType)
+	return &item, nil
+}
+
+// Search returns up to count movies or series matching query
+func (c *Client) Search(mediaType, query string, count int) ([]base.BaseMedia, error) {
+	res := []base.BaseMedia{}
+	for n := 1; len(res) < count; n++ {
+		var p page
+		if err := c.get("/search/"+mediaType, url.Values{"query": {query}, "page": {strconv.Itoa(n)}}, &p); err != nil {
+			return nil, err
+		}
+		for _, m := range p.Results {
+			if len(res) == count {
+				break
+			}
+			res = append(res, m.item(mediaType))
+		}
+		if n >= p.TotalPages || len(p.Results) == 0 {
+			break
+		}
+	}
+	return res, nil
+}
+
+// accountList fetches every page of a list of a TMDB account, list is rated or watchlist
+func (c *Client) accountList(account, list, mediaType string) ([]media, error) {
+	kind := "movies"
+	if mediaType == MediaTypeTV {
+		kind = "tv"
+	}
+
+	var res []media
+	for n := 1; n <= maxPages; n++ {
+		var p page
+		path := "/account/" + url.PathEscape(account) + "/" + list + "/" + kind
+		if err := c.get(path, url.Values{"page": {strconv.Itoa(n)}}, &p); err != nil {
+			return nil, err
+		}
+		res = append(res, p.Results...)
+		if n >= p.TotalPages || len(p.Results) == 0 {
+			break
+		}
+	}
+	return res, nil
+}
+
+// UserList fetches the rated and watchlisted movies or series of a TMDB account
+// TMDB doesn't track progress, rated titles count as completed with their rating as score
+// and watchlisted ones as planned, titles on both lists are returned once as rated
+// Account lists carry no runtimes or episode counts, so the details of rated titles are fetched to complete their progress
+func (c *Client) UserList(mediaType, account string) ([]base.BaseMedia, error) {
+	rated, err := c.accountList(account, "rated", mediaType)
+	if err != nil {
+		return nil, err
+	}
+	watchlist, err := c.accountList(account, "watchlist", mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]base.BaseMedia, 0, len(rated)+len(watchlist))
+	seen := make(map[int]bool, len(rated))
+	for _, m := range rated {
+		seen[m.ID] = true
+		item, err := c.Details(mediaType, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		item.Status = base.StatusCompleted
+		item.ProgressCurrent = item.ProgressTotal
+		item.Score = m.Rating * 10
+		res = append(res, *item)
+	}
+	for _, m := range watchlist {
+		if seen[m.ID] {
+			continue
+		}
+		item := m.item(mediaType)
+		item.Status = base.StatusPlanningWatch
+		res = append(res, item)
+	}
+	return res, nil
+}
@@ -0,0 +1,110 @@
+package tmdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"everythingtracker/base"
+	"everythingtracker/internal/httpjson"
+)
+
+// TestUserList checks that rated titles are completed with the total from their details
+// and that watchlisted ones are only returned when they aren't rated
+func TestUserList(t *testing.T) {
+	mux := http.NewServeMux()
+	pages := map[string][]string{
+		"/account/42/rated/movies": {
+			`{"page":1,"total_pages":2,"results":[{"id":603,"title":"The Matrix","rating":9}]}`,
+			`{"page":2,"total_pages":2,"results":[{"id":604,"title":"The Matrix Reloaded","rating":6.5}]}`,
+		},
+		"/account/42/watchlist/movies": {
+			`{"page":1,"total_pages":1,"results":[{"id":604,"title":"The Matrix Reloaded"},{"id":605,"title":"The Matrix Revolutions","runtime":129}]}`,
+		},
+		"/account/42/rated/tv":     {`{"page":1,"total_pages":1,"results":[{"id":1399,"name":"Game of Thrones","rating":8}]}`},
+		"/account/42/watchlist/tv": {`{"page":1,"total_pages":1,"results":[]}`},
+	}
+	for path, bodies := range pages {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			var n int
+			fmt.Sscan(r.URL.Query().Get("page"), &n)
+			w.Write([]byte(bodies[n-1]))
+		})
+	}
+	details := map[string]int{}
+	detail := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			details[r.URL.Path]++
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/movie/603", detail(`{"id":603,"title":"The Matrix","runtime":136}`))
+	mux.HandleFunc("/movie/604", detail(`{"id":604,"title":"The Matrix Reloaded","runtime":138}`))
+	mux.HandleFunc("/tv/1399", detail(`{"id":1399,"name":"Game of Thrones","number_of_episodes":73,
+		"seasons":[{"season_number":0,"episode_count":14},{"season_number":1,"episode_count":10},{"season_number":2,"episode_count":10}]}`))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := &Client{BaseURL: srv.URL}
+
+	movies, err := c.UserList(MediaTypeMovie, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[int]base.BaseMedia)
+	for _, item := range movies {
+		byID[item.ExternalID] = item
+	}
+	if len(movies) != 3 || len(byID) != 3 {
+		t.Fatalf("got %+v, want the 2 rated and 1 only watchlisted movie once each", movies)
+	}
+	if m := byID[603]; m.Status != base.StatusCompleted || m.ProgressCurrent != 136 || m.ProgressTotal != 136 || m.Score != 90 {
+		t.Errorf("rated movie = %+v", m)
+	}
+	if m := byID[604]; m.Status != base.StatusCompleted || m.ProgressCurrent != 138 || m.Score != 65 {
+		t.Errorf("rated and watchlisted movie = %+v", m)
+	}
+	// watchlisted titles aren't looked up and start without progress
+	if m := byID[605]; m.Status != base.StatusPlanningWatch || m.ProgressCurrent != 0 || m.ProgressTotal != 129 {
+		t.Errorf("watchlisted movie = %+v", m)
+	}
+	if len(details) != 2 || details["/movie/605"] != 0 {
+		t.Errorf("details fetched = %v", details)
+	}
+
+	// specials in season 0 don't count towards the completed episodes
+	series, err := c.UserList(MediaTypeTV, "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].ProgressCurrent != 73 || len(series[0].Seasons) != 2 || series[0].Status != base.StatusCompleted {
+		t.Errorf("series = %+v", series)
+	}
+
+	if _, err := c.UserList(MediaTypeMovie, "7"); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"status_code":7,"status_message":"Invalid API key: You must be granted a valid key."}`, "tmdb: Invalid API key: You must be granted a valid key."},
+		{`{"status_code":7}`, "tmdb responded with 401 Unauthorized"},
+		{`<html>`, "tmdb responded with 401 Unauthorized"},
+	}
+	for _, tt := range tests {
+		err := apiError(&httpjson.StatusError{Status: "401 Unauthorized", Body: []byte(tt.body)})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("apiError(%s) = %v, want %q", tt.body, err, tt.want)
+		}
+	}
+
+	other := errors.New("connection refused")
+	if err := apiError(other); err != other {
+		t.Errorf("apiError of a transport error = %v", err)
+	}
+}